@@ -0,0 +1,370 @@
+// Package asm builds compiled programs from the textual listing printed by
+// package disasm, so that assembling a listing and disassembling the result
+// gives the same text back.
+//
+// A listing consists of directives, labels and instructions, one per line.
+// Everything after a ';' outside of a string is a comment.
+//
+//	.constant 0 integer 10          defines constant 0
+//	.constant 1 string "ten"        defines constant 1
+//	.main                           starts the main program
+//	.function 2 locals=1 params=1   starts the function stored as constant 2
+//	L1:                             labels the next instruction
+//	0005 OpJumpNotTruthy L1         an instruction; the offset is optional
+//	.byte 255                       a raw byte
+//
+// Instructions use the mnemonics of package opcode. Jumps take a label or an
+// offset. Constants have to be numbered from 0 without gaps.
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gocompiler/compiler"
+	"gocompiler/ir"
+	"gocompiler/opcode"
+)
+
+// section collects the instructions of the main program or of a function
+// until all labels are known.
+type section struct {
+	name   string
+	items  []item
+	size   int
+	labels map[string]int
+	// function is the constant index of the function, or -1 for the main
+	// program.
+	function int
+}
+
+type item struct {
+	line     int
+	op       opcode.Opcode
+	operands []string
+	raw      []byte
+}
+
+type assembler struct {
+	line      int
+	main      *section
+	sections  []*section
+	current   *section
+	constants map[int]ir.Object
+}
+
+func Assemble(input string) (*compiler.Bytecode, error) {
+	a := &assembler{constants: make(map[int]ir.Object)}
+
+	for i, line := range strings.Split(input, "\n") {
+		a.line = i + 1
+
+		err := a.parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", a.line, err)
+		}
+	}
+
+	constants := make([]ir.Object, len(a.constants))
+	for i := range constants {
+		c, ok := a.constants[i]
+		if !ok {
+			return nil, fmt.Errorf("constant %d is missing", i)
+		}
+		constants[i] = c
+	}
+
+	bytecode := &compiler.Bytecode{Instructions: opcode.Instructions{}, Constants: constants}
+
+	for _, s := range a.sections {
+		ins, err := s.encode()
+		if err != nil {
+			return nil, err
+		}
+
+		if s.function < 0 {
+			bytecode.Instructions = ins
+		} else {
+			constants[s.function].(*ir.CompiledFunction).Instructions = ins
+		}
+	}
+
+	return bytecode, nil
+}
+
+func (a *assembler) parseLine(line string) error {
+	fields, err := split(line)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch {
+	case fields[0] == ".constant":
+		return a.parseConstant(fields[1:])
+	case fields[0] == ".main":
+		if len(fields) != 1 {
+			return fmt.Errorf(".main takes no arguments")
+		}
+		if a.main != nil {
+			return fmt.Errorf(".main defined twice")
+		}
+		a.main = a.newSection("main program", -1)
+		return nil
+	case fields[0] == ".function":
+		return a.parseFunction(fields[1:])
+	}
+
+	if a.current == nil {
+		return fmt.Errorf("%s outside of .main or .function", fields[0])
+	}
+
+	if len(fields) == 1 && strings.HasSuffix(fields[0], ":") {
+		label := strings.TrimSuffix(fields[0], ":")
+		if !isLabel(label) {
+			return fmt.Errorf("invalid label %q", label)
+		}
+		if _, ok := a.current.labels[label]; ok {
+			return fmt.Errorf("label %s defined twice", label)
+		}
+		a.current.labels[label] = a.current.size
+		return nil
+	}
+
+	// Offsets printed by the disassembler are informational only.
+	if isNumber(fields[0]) {
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return fmt.Errorf("missing instruction after offset")
+		}
+	}
+
+	if fields[0] == ".byte" {
+		if len(fields) != 2 {
+			return fmt.Errorf(".byte takes one value")
+		}
+		b, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid byte %q", fields[1])
+		}
+		a.current.add(item{line: a.line, raw: []byte{byte(b)}}, 1)
+		return nil
+	}
+
+	op, ok := opcode.LookupName(fields[0])
+	if !ok {
+		return fmt.Errorf("unknown instruction %s", fields[0])
+	}
+
+	def, _ := opcode.Lookup(byte(op))
+	if len(fields)-1 != len(def.OperandWidths) {
+		return fmt.Errorf("%s takes %d operands, got %d", def.Name, len(def.OperandWidths), len(fields)-1)
+	}
+
+	a.current.add(item{line: a.line, op: op, operands: fields[1:]}, 1+def.Width())
+	return nil
+}
+
+func (a *assembler) parseConstant(fields []string) error {
+	if len(fields) != 3 {
+		return fmt.Errorf("usage: .constant <index> <type> <value>")
+	}
+
+	index, err := a.constantIndex(fields[0])
+	if err != nil {
+		return err
+	}
+
+	switch fields[1] {
+	case "integer":
+		value, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", fields[2])
+		}
+		a.constants[index] = &ir.Integer{Value: value}
+	case "string":
+		value, err := strconv.Unquote(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid string %s", fields[2])
+		}
+		a.constants[index] = &ir.String{Value: value}
+	default:
+		return fmt.Errorf("unknown constant type %s", fields[1])
+	}
+
+	return nil
+}
+
+func (a *assembler) parseFunction(fields []string) error {
+	if len(fields) != 3 {
+		return fmt.Errorf("usage: .function <index> locals=<n> params=<n>")
+	}
+
+	index, err := a.constantIndex(fields[0])
+	if err != nil {
+		return err
+	}
+
+	locals, err := attribute(fields[1], "locals")
+	if err != nil {
+		return err
+	}
+
+	params, err := attribute(fields[2], "params")
+	if err != nil {
+		return err
+	}
+
+	a.constants[index] = &ir.CompiledFunction{NumLocals: locals, NumParameters: params}
+	a.newSection(fmt.Sprintf("function %d", index), index)
+
+	return nil
+}
+
+func (a *assembler) constantIndex(field string) (int, error) {
+	index, err := strconv.Atoi(field)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid constant index %q", field)
+	}
+
+	if _, ok := a.constants[index]; ok {
+		return 0, fmt.Errorf("constant %d defined twice", index)
+	}
+
+	return index, nil
+}
+
+func (a *assembler) newSection(name string, function int) *section {
+	s := &section{name: name, labels: make(map[string]int), function: function}
+	a.sections = append(a.sections, s)
+	a.current = s
+
+	return s
+}
+
+func (s *section) add(it item, size int) {
+	s.items = append(s.items, it)
+	s.size += size
+}
+
+func (s *section) encode() (opcode.Instructions, error) {
+	ins := opcode.Instructions{}
+
+	for _, it := range s.items {
+		if it.raw != nil {
+			ins = append(ins, it.raw...)
+			continue
+		}
+
+		def, _ := opcode.Lookup(byte(it.op))
+		operands := make([]int, len(it.operands))
+
+		for i, field := range it.operands {
+			value, err := strconv.Atoi(field)
+			if err == nil {
+				operands[i] = value
+				continue
+			}
+
+			if it.op != opcode.OpJump && it.op != opcode.OpJumpNotTruthy {
+				return nil, fmt.Errorf("line %d: invalid operand %q", it.line, field)
+			}
+
+			target, ok := s.labels[field]
+			if !ok {
+				return nil, fmt.Errorf("line %d: undefined label %s in %s", it.line, field, s.name)
+			}
+			operands[i] = target
+		}
+
+		if !def.Fits(operands...) {
+			return nil, fmt.Errorf("line %d: operands %v out of range for %s", it.line, operands, def.Name)
+		}
+
+		ins = append(ins, opcode.Make(it.op, operands...)...)
+	}
+
+	return ins, nil
+}
+
+func attribute(field, name string) (int, error) {
+	if !strings.HasPrefix(field, name+"=") {
+		return 0, fmt.Errorf("expected %s=<n>, got %q", name, field)
+	}
+
+	value, err := strconv.Atoi(strings.TrimPrefix(field, name+"="))
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, field)
+	}
+
+	return value, nil
+}
+
+// split breaks line into whitespace separated fields, keeping quoted strings
+// together and dropping the comment.
+func split(line string) ([]string, error) {
+	var fields []string
+
+	for i := 0; i < len(line); {
+		switch {
+		case line[i] == ';':
+			return fields, nil
+		case unicode.IsSpace(rune(line[i])):
+			i++
+		case line[i] == '"':
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			fields = append(fields, line[i:end+1])
+			i = end + 1
+		default:
+			start := i
+			for i < len(line) && line[i] != ';' && !unicode.IsSpace(rune(line[i])) {
+				i++
+			}
+			fields = append(fields, line[start:i])
+		}
+	}
+
+	return fields, nil
+}
+
+func isLabel(s string) bool {
+	if s == "" || isNumber(s) {
+		return false
+	}
+
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,171 @@
+package asm
+
+import (
+	"bytes"
+	"testing"
+
+	"gocompiler/compiler"
+	"gocompiler/disasm"
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/opcode"
+	"gocompiler/parser"
+)
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		`1 + 2; "a;b c" + "d"`,
+		"if (1 > 2) { 10 } else { 20 }; if (true) { 1 }",
+		`let h = {"a": [1, 2, 3]}; h["a"][1]`,
+		`let newAdder = function(a, b) {
+			let c = a + b;
+			function(d) { c + d };
+		};
+		newAdder(1, 2)(8);`,
+	}
+
+	for _, input := range inputs {
+		p := parser.New(lexer.New(input))
+		comp := compiler.New()
+
+		err := comp.Compile(p.ParseProgram())
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		listing := disasm.Disassemble(bytecode)
+
+		assembled, err := Assemble(listing)
+		if err != nil {
+			t.Fatalf("assembler error for\n%s: %s", listing, err)
+		}
+
+		if !bytes.Equal(assembled.Instructions, bytecode.Instructions) {
+			t.Errorf("wrong instructions.\nwant=%q\ngot=%q", bytecode.Instructions, assembled.Instructions)
+		}
+
+		if again := disasm.Disassemble(assembled); again != listing {
+			t.Errorf("listing changed.\nwant=\n%s\ngot=\n%s", listing, again)
+		}
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	input := `
+; a function that loops until its argument is falsy
+.function 1 locals=1 params=1
+loop:
+	OpGetLocal 0
+	OpJumpNotTruthy done
+	OpGetLocal 0
+	OpConstant 0 ; one
+	OpSub
+	OpSetLocal 0
+	OpJump loop
+done:
+	OpGetLocal 0
+	OpReturnValue
+
+.constant 0 integer 1
+
+.main
+	OpClosure 1 0
+	OpConstant 0
+	OpCall 1
+	OpPop
+`
+
+	bytecode, err := Assemble(input)
+	if err != nil {
+		t.Fatalf("assembler error: %s", err)
+	}
+
+	expected := concat(
+		opcode.Make(opcode.OpClosure, 1, 0),
+		opcode.Make(opcode.OpConstant, 0),
+		opcode.Make(opcode.OpCall, 1),
+		opcode.Make(opcode.OpPop),
+	)
+	if !bytes.Equal(bytecode.Instructions, expected) {
+		t.Errorf("wrong main instructions.\nwant=%q\ngot=%q", expected, bytecode.Instructions)
+	}
+
+	if len(bytecode.Constants) != 2 {
+		t.Fatalf("wrong number of constants. got=%d", len(bytecode.Constants))
+	}
+
+	fn, ok := bytecode.Constants[1].(*ir.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 1 is not a function: %T", bytecode.Constants[1])
+	}
+
+	if fn.NumLocals != 1 || fn.NumParameters != 1 {
+		t.Errorf("wrong function attributes: %+v", fn)
+	}
+
+	expected = concat(
+		// 0000
+		opcode.Make(opcode.OpGetLocal, 0),
+		// 0002
+		opcode.Make(opcode.OpJumpNotTruthy, 16),
+		// 0005
+		opcode.Make(opcode.OpGetLocal, 0),
+		// 0007
+		opcode.Make(opcode.OpConstant, 0),
+		// 0010
+		opcode.Make(opcode.OpSub),
+		// 0011
+		opcode.Make(opcode.OpSetLocal, 0),
+		// 0013
+		opcode.Make(opcode.OpJump, 0),
+		// 0016
+		opcode.Make(opcode.OpGetLocal, 0),
+		// 0018
+		opcode.Make(opcode.OpReturnValue),
+	)
+	if !bytes.Equal(fn.Instructions, expected) {
+		t.Errorf("wrong function instructions.\nwant=%q\ngot=%q", expected, fn.Instructions)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{".main\nOpFoo", "line 2: unknown instruction OpFoo"},
+		{"OpPop", "line 1: OpPop outside of .main or .function"},
+		{".main\nOpConstant", "line 2: OpConstant takes 1 operands, got 0"},
+		{".main\nOpJump nowhere", "line 2: undefined label nowhere in main program"},
+		{".main\nOpGetLocal 256", "line 2: operands [256] out of range for OpGetLocal"},
+		{".constant 1 integer 1", "constant 0 is missing"},
+		{".constant 0 integer 1\n.constant 0 string \"a\"", "line 2: constant 0 defined twice"},
+		{`.constant 0 string "abc`, "line 1: unterminated string"},
+		{".function 0 locals=x params=0", `line 1: invalid locals "locals=x"`},
+		{".main\nL1:\nL1:", "line 3: label L1 defined twice"},
+	}
+
+	for _, tt := range tests {
+		_, err := Assemble(tt.input)
+		if err == nil {
+			t.Errorf("expected error %q but got none", tt.expected)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func concat(s ...opcode.Instructions) opcode.Instructions {
+	out := opcode.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
@@ -170,6 +170,36 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ImportStatement is import "path". It makes the bindings that the module at
+// Path exports visible in the importing file.
+type ImportStatement struct {
+	Token token.Token
+	Path  string
+}
+
+func (is *ImportStatement) statementNode() {}
+
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " \"" + is.Path + "\";"
+}
+
+// ExportStatement is a let statement prefixed with export, which files that
+// import the module can see.
+type ExportStatement struct {
+	Token     token.Token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode() {}
+
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -267,6 +297,35 @@ func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
+// InterpolatedString is a string such as "a${x}b". Its parts alternate
+// between the text around the interpolations, as StringLiterals, and the
+// interpolated expressions. Empty text is left out.
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode() {}
+
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for _, part := range is.Parts {
+		if str, ok := part.(*StringLiteral); ok {
+			out.WriteString(str.String())
+			continue
+		}
+
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
@@ -294,6 +353,35 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// MacroLiteral is macro(params) { body }. Macros are defined and expanded
+// before a program runs, so that compiled programs never contain them.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	var params []string
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString(token.LeftParen)
+	out.WriteString(strings.Join(params, token.Comma+" "))
+	out.WriteString(token.RightParen)
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -318,9 +406,15 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// HashPair is a key and value of a HashLiteral.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
 type HashLiteral struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	Pairs []HashPair // in source order
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -331,8 +425,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	var pairs []string
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+token.Colon+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+token.Colon+pair.Value.String())
 	}
 
 	out.WriteString(token.LeftBrace)
@@ -342,6 +436,37 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// SliceExpression is left[low:high]. Low and High are nil when omitted.
+type SliceExpression struct {
+	Token token.Token
+	Left  Expression
+	Low   Expression
+	High  Expression
+}
+
+func (se *SliceExpression) expressionNode() {}
+
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(token.LeftParen)
+	out.WriteString(se.Left.String())
+	out.WriteString(token.LeftBracket)
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(token.Colon)
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString(token.RightBracket)
+	out.WriteString(token.RightParen)
+
+	return out.String()
+}
+
 type IndexExpression struct {
 	Token token.Token
 	Left  Expression
@@ -0,0 +1,216 @@
+package ast
+
+// Copy returns a deep copy of the tree rooted at node, so that the copy can
+// be changed, for example with Modify, without changing node. Nil and
+// missing children stay nil.
+func Copy(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		if n == nil {
+			return n
+		}
+		return &Program{Statements: copyStatements(n.Statements)}
+	case *BlockStatement:
+		return copyBlock(n)
+	case *ExpressionStatement:
+		if n == nil {
+			return n
+		}
+		return &ExpressionStatement{Token: n.Token, Expression: copyExpression(n.Expression)}
+	case *LetStatement:
+		if n == nil {
+			return n
+		}
+		return &LetStatement{Token: n.Token, Name: copyIdentifier(n.Name), Value: copyExpression(n.Value)}
+	case *ReturnStatement:
+		if n == nil {
+			return n
+		}
+		return &ReturnStatement{Token: n.Token, ReturnValue: copyExpression(n.ReturnValue)}
+	case *ImportStatement:
+		if n == nil {
+			return n
+		}
+		c := *n
+		return &c
+	case *ExportStatement:
+		if n == nil {
+			return n
+		}
+
+		c := &ExportStatement{Token: n.Token}
+		if n.Statement != nil {
+			c.Statement = Copy(n.Statement).(*LetStatement)
+		}
+
+		return c
+	case Expression:
+		return copyExpression(n)
+	default:
+		return node
+	}
+}
+
+func copyExpression(exp Expression) Expression {
+	switch n := exp.(type) {
+	case *Identifier:
+		return copyIdentifier(n)
+	case *Boolean:
+		if n == nil {
+			return n
+		}
+		c := *n
+		return &c
+	case *IntegerLiteral:
+		if n == nil {
+			return n
+		}
+		c := *n
+		return &c
+	case *StringLiteral:
+		if n == nil {
+			return n
+		}
+		c := *n
+		return &c
+	case *InterpolatedString:
+		if n == nil {
+			return n
+		}
+		return &InterpolatedString{Token: n.Token, Parts: copyExpressions(n.Parts)}
+	case *PrefixExpression:
+		if n == nil {
+			return n
+		}
+		return &PrefixExpression{Token: n.Token, Operator: n.Operator, Right: copyExpression(n.Right)}
+	case *InfixExpression:
+		if n == nil {
+			return n
+		}
+		return &InfixExpression{
+			Token:    n.Token,
+			Left:     copyExpression(n.Left),
+			Operator: n.Operator,
+			Right:    copyExpression(n.Right),
+		}
+	case *IfExpression:
+		if n == nil {
+			return n
+		}
+		return &IfExpression{
+			Token:       n.Token,
+			Condition:   copyExpression(n.Condition),
+			Consequence: copyBlock(n.Consequence),
+			Alternative: copyBlock(n.Alternative),
+		}
+	case *FunctionLiteral:
+		if n == nil {
+			return n
+		}
+		return &FunctionLiteral{Token: n.Token, Parameters: copyIdentifiers(n.Parameters), Body: copyBlock(n.Body)}
+	case *MacroLiteral:
+		if n == nil {
+			return n
+		}
+		return &MacroLiteral{Token: n.Token, Parameters: copyIdentifiers(n.Parameters), Body: copyBlock(n.Body)}
+	case *CallExpression:
+		if n == nil {
+			return n
+		}
+		return &CallExpression{Token: n.Token, Function: copyExpression(n.Function), Arguments: copyExpressions(n.Arguments)}
+	case *ArrayLiteral:
+		if n == nil {
+			return n
+		}
+		return &ArrayLiteral{Token: n.Token, Elements: copyExpressions(n.Elements)}
+	case *HashLiteral:
+		if n == nil {
+			return n
+		}
+
+		c := &HashLiteral{Token: n.Token}
+		if n.Pairs != nil {
+			c.Pairs = make([]HashPair, len(n.Pairs))
+		}
+		for i, pair := range n.Pairs {
+			c.Pairs[i] = HashPair{Key: copyExpression(pair.Key), Value: copyExpression(pair.Value)}
+		}
+
+		return c
+	case *IndexExpression:
+		if n == nil {
+			return n
+		}
+		return &IndexExpression{Token: n.Token, Left: copyExpression(n.Left), Index: copyExpression(n.Index)}
+	case *SliceExpression:
+		if n == nil {
+			return n
+		}
+		return &SliceExpression{
+			Token: n.Token,
+			Left:  copyExpression(n.Left),
+			Low:   copyExpression(n.Low),
+			High:  copyExpression(n.High),
+		}
+	default:
+		return exp
+	}
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+
+	c := *ident
+	return &c
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+
+	c := make([]Statement, len(statements))
+	for i, stmt := range statements {
+		if stmt != nil {
+			c[i] = Copy(stmt).(Statement)
+		}
+	}
+
+	return c
+}
+
+func copyExpressions(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+
+	c := make([]Expression, len(list))
+	for i, exp := range list {
+		c[i] = copyExpression(exp)
+	}
+
+	return c
+}
+
+func copyIdentifiers(list []*Identifier) []*Identifier {
+	if list == nil {
+		return nil
+	}
+
+	c := make([]*Identifier, len(list))
+	for i, ident := range list {
+		c[i] = copyIdentifier(ident)
+	}
+
+	return c
+}
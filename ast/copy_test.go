@@ -0,0 +1,64 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	program, _ := everyNode()
+
+	copied := Copy(program)
+	if !reflect.DeepEqual(copied, program) {
+		t.Fatalf("copy differs.\nwant=%s\ngot =%s", program, copied)
+	}
+
+	// No node may be shared between the tree and its copy.
+	original := map[Node]bool{}
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			original[node] = true
+		}
+		return true
+	})
+
+	Inspect(copied, func(node Node) bool {
+		if node != nil && original[node] {
+			t.Errorf("%T %s is shared", node, node)
+		}
+		return true
+	})
+
+	Modify(copied, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return integer(0)
+		}
+		return node
+	})
+
+	if reflect.DeepEqual(copied, program) {
+		t.Errorf("changing the copy didn't change it")
+	}
+
+	again, _ := everyNode()
+	if !reflect.DeepEqual(program, again) {
+		t.Errorf("changing the copy changed the original: %s", program)
+	}
+}
+
+func TestCopyNil(t *testing.T) {
+	nodes := []Node{
+		nil,
+		(*Program)(nil),
+		(*IfExpression)(nil),
+		&IfExpression{Condition: ident("x"), Consequence: block()},
+		&SliceExpression{Left: ident("a")},
+		&FunctionLiteral{Body: block()},
+	}
+
+	for _, node := range nodes {
+		if got := Copy(node); !reflect.DeepEqual(got, node) {
+			t.Errorf("wrong copy of %#v: %#v", node, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package ast
+
+// ModifierFunc returns the node to put in place of node. Returning node
+// itself leaves it where it is.
+type ModifierFunc func(node Node) Node
+
+// Modify rewrites the tree rooted at node bottom-up: the children of a node
+// are modified, and replaced in the node, before the node itself is passed to
+// modifier. It returns what modifier returns for node.
+//
+// Like Walk, Modify covers every node type and skips missing children. A
+// replacement must fit the place it goes into: an Expression for an
+// expression, a Statement for a statement, an *Identifier for a name or a
+// parameter, a *BlockStatement for a block and a *LetStatement for the
+// statement of an export. Anything else panics.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+	case *BlockStatement:
+		modifyStatements(n.Statements, modifier)
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+	case *LetStatement:
+		if n.Name != nil {
+			n.Name = Modify(n.Name, modifier).(*Identifier)
+		}
+		n.Value = modifyExpression(n.Value, modifier)
+	case *ReturnStatement:
+		n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+	case *ExportStatement:
+		if n.Statement != nil {
+			n.Statement = Modify(n.Statement, modifier).(*LetStatement)
+		}
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		if n.Consequence != nil {
+			n.Consequence = Modify(n.Consequence, modifier).(*BlockStatement)
+		}
+		if n.Alternative != nil {
+			n.Alternative = Modify(n.Alternative, modifier).(*BlockStatement)
+		}
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = Modify(param, modifier).(*Identifier)
+		}
+		if n.Body != nil {
+			n.Body = Modify(n.Body, modifier).(*BlockStatement)
+		}
+	case *MacroLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = Modify(param, modifier).(*Identifier)
+		}
+		if n.Body != nil {
+			n.Body = Modify(n.Body, modifier).(*BlockStatement)
+		}
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+	case *InterpolatedString:
+		modifyExpressions(n.Parts, modifier)
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+	case *HashLiteral:
+		for i, pair := range n.Pairs {
+			n.Pairs[i].Key = modifyExpression(pair.Key, modifier)
+			n.Pairs[i].Value = modifyExpression(pair.Value, modifier)
+		}
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+	case *SliceExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Low = modifyExpression(n.Low, modifier)
+		n.High = modifyExpression(n.High, modifier)
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) {
+	for i, stmt := range statements {
+		if stmt != nil {
+			statements[i] = Modify(stmt, modifier).(Statement)
+		}
+	}
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+
+	return Modify(exp, modifier).(Expression)
+}
+
+func modifyExpressions(list []Expression, modifier ModifierFunc) {
+	for i, exp := range list {
+		list[i] = modifyExpression(exp, modifier)
+	}
+}
@@ -0,0 +1,174 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return integer(1) }
+	two := func() Expression { return integer(2) }
+
+	turnOneIntoTwo := func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok && integer.Value == 1 {
+			return two()
+		}
+		return node
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{expression(one())}},
+			&Program{Statements: []Statement{expression(two())}},
+		},
+		{infix(one(), "+", two()), infix(two(), "+", two())},
+		{infix(two(), "+", one()), infix(two(), "+", two())},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&SliceExpression{Left: one(), High: one()},
+			&SliceExpression{Left: two(), High: two()},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: block(expression(one())),
+				Alternative: block(expression(one())),
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: block(expression(two())),
+				Alternative: block(expression(two())),
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: ident("a"), Value: one()},
+			&LetStatement{Name: ident("a"), Value: two()},
+		},
+		{
+			&ExportStatement{Statement: &LetStatement{Name: ident("a"), Value: one()}},
+			&ExportStatement{Statement: &LetStatement{Name: ident("a"), Value: two()}},
+		},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(expression(one()))},
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(expression(two()))},
+		},
+		{
+			&MacroLiteral{Parameters: []*Identifier{}, Body: block(expression(one()))},
+			&MacroLiteral{Parameters: []*Identifier{}, Body: block(expression(two()))},
+		},
+		{
+			&CallExpression{Function: one(), Arguments: []Expression{one()}},
+			&CallExpression{Function: two(), Arguments: []Expression{two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&InterpolatedString{Parts: []Expression{str("a"), one()}},
+			&InterpolatedString{Parts: []Expression{str("a"), two()}},
+		},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal.\nwant=%#v\ngot =%#v", tt.expected, modified)
+		}
+	}
+}
+
+func TestModifyBottomUp(t *testing.T) {
+	// (1 + 2) + 3 folds into 6 only if the inner sum is folded first.
+	fold := func(node Node) Node {
+		sum, ok := node.(*InfixExpression)
+		if !ok || sum.Operator != "+" {
+			return node
+		}
+
+		left, ok := sum.Left.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+		right, ok := sum.Right.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		return integer(left.Value + right.Value)
+	}
+
+	program := &Program{Statements: []Statement{
+		expression(infix(infix(integer(1), "+", integer(2)), "+", integer(3))),
+	}}
+
+	Modify(program, fold)
+
+	if program.String() != "6" {
+		t.Errorf("wrong program. want=%q, got=%q", "6", program.String())
+	}
+}
+
+func TestModifyReplacesStatements(t *testing.T) {
+	program, _ := everyNode()
+
+	// Replace every expression, import and export statement with the let
+	// statement that starts the program.
+	let := program.Statements[0]
+	Modify(program, func(node Node) Node {
+		switch node.(type) {
+		case *ExpressionStatement, *ImportStatement, *ExportStatement:
+			return let
+		}
+		return node
+	})
+
+	for i, stmt := range program.Statements {
+		if stmt != let {
+			t.Errorf("statement %d not replaced: %s", i, stmt)
+		}
+	}
+
+	// The block inside the if expression is not reachable any more, but
+	// the one in the function body is, and its return statement stays.
+	body := let.(*LetStatement).Value.(*FunctionLiteral).Body
+	if _, ok := body.Statements[0].(*ReturnStatement); !ok {
+		t.Errorf("return statement replaced: %T", body.Statements[0])
+	}
+}
+
+func TestModifyWrongReplacementPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("replacing an identifier with an integer didn't panic")
+		}
+	}()
+
+	let := &LetStatement{Name: ident("a"), Value: integer(1)}
+	Modify(let, func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return integer(2)
+		}
+		return node
+	})
+}
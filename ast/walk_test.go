@@ -0,0 +1,201 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gocompiler/token"
+)
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.Identifier, Literal: name}, Value: name}
+}
+
+func integer(value int64) *IntegerLiteral {
+	literal := fmt.Sprint(value)
+	return &IntegerLiteral{Token: token.Token{Type: token.Int, Literal: literal}, Value: value}
+}
+
+func str(value string) *StringLiteral {
+	return &StringLiteral{Token: token.Token{Type: token.String, Literal: value}, Value: value}
+}
+
+func infix(left Expression, operator string, right Expression) *InfixExpression {
+	return &InfixExpression{
+		Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+		Left:     left,
+		Operator: operator,
+		Right:    right,
+	}
+}
+
+func block(statements ...Statement) *BlockStatement {
+	return &BlockStatement{Token: token.Token{Type: token.LeftBrace, Literal: "{"}, Statements: statements}
+}
+
+func expression(exp Expression) *ExpressionStatement {
+	return &ExpressionStatement{Expression: exp}
+}
+
+// everyNode returns a program with every kind of node in it, and the kinds
+// in the order Walk visits them.
+func everyNode() (*Program, []string) {
+	program := &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.Let, Literal: "let"},
+			Name:  ident("f"),
+			Value: &FunctionLiteral{
+				Token:      token.Token{Type: token.Function, Literal: "function"},
+				Parameters: []*Identifier{ident("x")},
+				Body: block(
+					&ReturnStatement{
+						Token:       token.Token{Type: token.Return, Literal: "return"},
+						ReturnValue: &PrefixExpression{Operator: "-", Right: ident("x")},
+					},
+				),
+			},
+		},
+		expression(&IfExpression{
+			Condition:   &Boolean{Value: true},
+			Consequence: block(expression(integer(1))),
+			Alternative: block(),
+		}),
+		expression(&CallExpression{
+			Function:  ident("f"),
+			Arguments: []Expression{infix(integer(2), "+", integer(3))},
+		}),
+		expression(&IndexExpression{
+			Left: &ArrayLiteral{Elements: []Expression{integer(4)}},
+			Index: &HashLiteral{Pairs: []HashPair{
+				{Key: str("k"), Value: integer(5)},
+			}},
+		}),
+		expression(&SliceExpression{
+			Left: &InterpolatedString{Parts: []Expression{str("a"), ident("b")}},
+			High: integer(6),
+		}),
+		expression(&MacroLiteral{
+			Parameters: []*Identifier{ident("m")},
+			Body:       block(),
+		}),
+		&ImportStatement{Path: "lib"},
+		&ExportStatement{Statement: &LetStatement{Name: ident("e"), Value: integer(7)}},
+	}}
+
+	kinds := []string{
+		"*ast.Program",
+		"*ast.LetStatement", "*ast.Identifier",
+		"*ast.FunctionLiteral", "*ast.Identifier", "*ast.BlockStatement",
+		"*ast.ReturnStatement", "*ast.PrefixExpression", "*ast.Identifier",
+		"*ast.ExpressionStatement", "*ast.IfExpression", "*ast.Boolean",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.IntegerLiteral",
+		"*ast.BlockStatement",
+		"*ast.ExpressionStatement", "*ast.CallExpression", "*ast.Identifier",
+		"*ast.InfixExpression", "*ast.IntegerLiteral", "*ast.IntegerLiteral",
+		"*ast.ExpressionStatement", "*ast.IndexExpression",
+		"*ast.ArrayLiteral", "*ast.IntegerLiteral",
+		"*ast.HashLiteral", "*ast.StringLiteral", "*ast.IntegerLiteral",
+		"*ast.ExpressionStatement", "*ast.SliceExpression",
+		"*ast.InterpolatedString", "*ast.StringLiteral", "*ast.Identifier",
+		"*ast.IntegerLiteral",
+		"*ast.ExpressionStatement", "*ast.MacroLiteral", "*ast.Identifier",
+		"*ast.BlockStatement",
+		"*ast.ImportStatement",
+		"*ast.ExportStatement", "*ast.LetStatement", "*ast.Identifier", "*ast.IntegerLiteral",
+	}
+
+	return program, kinds
+}
+
+func TestInspect(t *testing.T) {
+	program, want := everyNode()
+
+	var got []string
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			got = append(got, fmt.Sprintf("%T", node))
+		}
+		return true
+	})
+
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("wrong nodes.\nwant=%v\ngot =%v", want, got)
+	}
+}
+
+type depthVisitor struct {
+	depth *int
+	max   *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+
+	*v.depth++
+	if *v.depth > *v.max {
+		*v.max = *v.depth
+	}
+
+	return v
+}
+
+func TestWalkPairsVisitNil(t *testing.T) {
+	program, _ := everyNode()
+
+	depth, max := 0, 0
+	Walk(depthVisitor{&depth, &max}, program)
+
+	if depth != 0 {
+		t.Errorf("Visit(nil) calls don't match visits: depth=%d", depth)
+	}
+
+	// Program, let, function, block, return, prefix, identifier.
+	if max != 7 {
+		t.Errorf("wrong max depth. want=7, got=%d", max)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program, _ := everyNode()
+
+	var identifiers []string
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral:
+			return false
+		case *Identifier:
+			identifiers = append(identifiers, node.Value)
+		}
+		return true
+	})
+
+	want := []string{"f", "f", "b", "m", "e"}
+	if strings.Join(identifiers, " ") != strings.Join(want, " ") {
+		t.Errorf("wrong identifiers. want=%v, got=%v", want, identifiers)
+	}
+}
+
+func TestWalkMissingChildren(t *testing.T) {
+	nodes := []Node{
+		&IfExpression{Condition: &Boolean{Value: true}, Consequence: block()},
+		&SliceExpression{Left: ident("a")},
+		&FunctionLiteral{},
+		&LetStatement{Value: integer(1)},
+		&ReturnStatement{},
+		&Program{Statements: []Statement{nil}},
+	}
+
+	for _, node := range nodes {
+		Inspect(node, func(n Node) bool {
+			if n != nil && reflect.ValueOf(n).IsNil() {
+				t.Errorf("visited a nil %T in %T", n, node)
+			}
+			return true
+		})
+	}
+}
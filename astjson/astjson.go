@@ -0,0 +1,231 @@
+// Package astjson converts syntax trees to and from JSON, for tools written
+// in other languages.
+//
+// Every node is an object whose "type" is the name of its ast type, such as
+// "LetStatement", followed by its "token" and its fields, named after the Go
+// fields in lower camel case. A token holds its "type", "literal" and
+// "position", which is left out when unknown:
+//
+//	{
+//		"type": "LetStatement",
+//		"token": {"type": "Let", "literal": "let", "position": {"line": 1, "column": 1}},
+//		"name": {"type": "Identifier", "token": {...}, "value": "x"},
+//		"value": {"type": "IntegerLiteral", "token": {...}, "value": 1}
+//	}
+//
+// Programs have no token, and the pairs of a HashLiteral are objects with a
+// "key" and a "value". Missing nodes and lists are null.
+//
+// The conversion is lossless: Unmarshal rebuilds the tree that Marshal was
+// given. Unmarshal also accepts trees that no parser produced, so generated
+// programs can be compiled directly. It rejects trees the compiler can't
+// handle, such as a statement where an expression must be, or a missing
+// operand. Tokens may be left out; only the fields carry meaning.
+package astjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"gocompiler/ast"
+	"gocompiler/token"
+)
+
+// Marshal returns the JSON encoding of node.
+func Marshal(node ast.Node) ([]byte, error) {
+	return json.Marshal(encodeNode(node))
+}
+
+// MarshalIndent is like Marshal but indents the output like json.Indent.
+func MarshalIndent(node ast.Node, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(encodeNode(node), prefix, indent)
+}
+
+// field is a member of an object. Objects keep their fields in order, so
+// that the type of a node comes first in the output.
+type field struct {
+	key   string
+	value interface{}
+}
+
+type object []field
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString("{")
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+
+	return buf.Bytes(), nil
+}
+
+func encodeNode(node ast.Node) interface{} {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return object{{"type", "Program"}, {"statements", encodeStatements(node.Statements)}}
+	case *ast.BlockStatement:
+		return nodeObject("BlockStatement", node.Token,
+			field{"statements", encodeStatements(node.Statements)})
+	case *ast.ExpressionStatement:
+		return nodeObject("ExpressionStatement", node.Token,
+			field{"expression", encodeNode(node.Expression)})
+	case *ast.LetStatement:
+		return nodeObject("LetStatement", node.Token,
+			field{"name", encodeNode(node.Name)},
+			field{"value", encodeNode(node.Value)})
+	case *ast.ReturnStatement:
+		return nodeObject("ReturnStatement", node.Token,
+			field{"returnValue", encodeNode(node.ReturnValue)})
+	case *ast.ImportStatement:
+		return nodeObject("ImportStatement", node.Token, field{"path", node.Path})
+	case *ast.ExportStatement:
+		return nodeObject("ExportStatement", node.Token,
+			field{"statement", encodeNode(node.Statement)})
+	case *ast.Identifier:
+		return nodeObject("Identifier", node.Token, field{"value", node.Value})
+	case *ast.Boolean:
+		return nodeObject("Boolean", node.Token, field{"value", node.Value})
+	case *ast.IntegerLiteral:
+		return nodeObject("IntegerLiteral", node.Token, field{"value", node.Value})
+	case *ast.StringLiteral:
+		return nodeObject("StringLiteral", node.Token, field{"value", node.Value})
+	case *ast.InterpolatedString:
+		return nodeObject("InterpolatedString", node.Token,
+			field{"parts", encodeExpressions(node.Parts)})
+	case *ast.PrefixExpression:
+		return nodeObject("PrefixExpression", node.Token,
+			field{"operator", node.Operator},
+			field{"right", encodeNode(node.Right)})
+	case *ast.InfixExpression:
+		return nodeObject("InfixExpression", node.Token,
+			field{"left", encodeNode(node.Left)},
+			field{"operator", node.Operator},
+			field{"right", encodeNode(node.Right)})
+	case *ast.IfExpression:
+		return nodeObject("IfExpression", node.Token,
+			field{"condition", encodeNode(node.Condition)},
+			field{"consequence", encodeNode(node.Consequence)},
+			field{"alternative", encodeNode(node.Alternative)})
+	case *ast.FunctionLiteral:
+		var params []interface{}
+		if node.Parameters != nil {
+			params = []interface{}{}
+		}
+		for _, param := range node.Parameters {
+			params = append(params, encodeNode(param))
+		}
+
+		return nodeObject("FunctionLiteral", node.Token,
+			field{"parameters", params},
+			field{"body", encodeNode(node.Body)})
+	case *ast.MacroLiteral:
+		var params []interface{}
+		if node.Parameters != nil {
+			params = []interface{}{}
+		}
+		for _, param := range node.Parameters {
+			params = append(params, encodeNode(param))
+		}
+
+		return nodeObject("MacroLiteral", node.Token,
+			field{"parameters", params},
+			field{"body", encodeNode(node.Body)})
+	case *ast.CallExpression:
+		return nodeObject("CallExpression", node.Token,
+			field{"function", encodeNode(node.Function)},
+			field{"arguments", encodeExpressions(node.Arguments)})
+	case *ast.ArrayLiteral:
+		return nodeObject("ArrayLiteral", node.Token,
+			field{"elements", encodeExpressions(node.Elements)})
+	case *ast.HashLiteral:
+		var pairs []interface{}
+		if node.Pairs != nil {
+			pairs = []interface{}{}
+		}
+		for _, pair := range node.Pairs {
+			pairs = append(pairs, object{
+				{"key", encodeNode(pair.Key)},
+				{"value", encodeNode(pair.Value)},
+			})
+		}
+
+		return nodeObject("HashLiteral", node.Token, field{"pairs", pairs})
+	case *ast.IndexExpression:
+		return nodeObject("IndexExpression", node.Token,
+			field{"left", encodeNode(node.Left)},
+			field{"index", encodeNode(node.Index)})
+	case *ast.SliceExpression:
+		return nodeObject("SliceExpression", node.Token,
+			field{"left", encodeNode(node.Left)},
+			field{"low", encodeNode(node.Low)},
+			field{"high", encodeNode(node.High)})
+	default:
+		return nil
+	}
+}
+
+func nodeObject(typ string, tok token.Token, fields ...field) object {
+	return append(object{{"type", typ}, {"token", encodeToken(tok)}}, fields...)
+}
+
+func encodeToken(tok token.Token) object {
+	o := object{{"type", string(tok.Type)}, {"literal", tok.Literal}}
+	if tok.Position != (token.Position{}) {
+		o = append(o, field{"position", object{
+			{"line", tok.Position.Line},
+			{"column", tok.Position.Column},
+		}})
+	}
+
+	return o
+}
+
+func encodeStatements(statements []ast.Statement) []interface{} {
+	if statements == nil {
+		return nil
+	}
+
+	list := []interface{}{}
+	for _, stmt := range statements {
+		list = append(list, encodeNode(stmt))
+	}
+
+	return list
+}
+
+func encodeExpressions(expressions []ast.Expression) []interface{} {
+	if expressions == nil {
+		return nil
+	}
+
+	list := []interface{}{}
+	for _, exp := range expressions {
+		list = append(list, encodeNode(exp))
+	}
+
+	return list
+}
@@ -0,0 +1,230 @@
+package astjson
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gocompiler/ast"
+	"gocompiler/difftest"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+)
+
+func TestMarshal(t *testing.T) {
+	program := parse(t, "let x = -1;")
+
+	data, err := Marshal(program)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+
+	expected := `{"type":"Program","statements":[` +
+		`{"type":"LetStatement","token":{"type":"Let","literal":"let","position":{"line":1,"column":1}},` +
+		`"name":{"type":"Identifier","token":{"type":"Identifier","literal":"x","position":{"line":1,"column":5}},"value":"x"},` +
+		`"value":{"type":"PrefixExpression","token":{"type":"-","literal":"-","position":{"line":1,"column":9}},"operator":"-",` +
+		`"right":{"type":"IntegerLiteral","token":{"type":"Int","literal":"1","position":{"line":1,"column":10}},"value":1}}}]}`
+
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot =%s", expected, data)
+	}
+}
+
+func TestMarshalNil(t *testing.T) {
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{nil, `null`},
+		{(*ast.Program)(nil), `null`},
+		{&ast.SliceExpression{Left: &ast.Identifier{Value: "a"}},
+			`{"type":"SliceExpression","token":{"type":"","literal":""},` +
+				`"left":{"type":"Identifier","token":{"type":"","literal":""},"value":"a"},"low":null,"high":null}`},
+		{&ast.ArrayLiteral{Elements: []ast.Expression{}},
+			`{"type":"ArrayLiteral","token":{"type":"","literal":""},"elements":[]}`},
+		{&ast.ArrayLiteral{},
+			`{"type":"ArrayLiteral","token":{"type":"","literal":""},"elements":null}`},
+	}
+
+	for _, tt := range tests {
+		data, err := Marshal(tt.node)
+		if err != nil {
+			t.Fatalf("Marshal failed: %s", err)
+		}
+
+		if string(data) != tt.expected {
+			t.Errorf("wrong JSON.\nwant=%s\ngot =%s", tt.expected, data)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"let add = function(a, b) { return a + b; }; add(1, 2);",
+		"if (1 < 2) { true } else { false };",
+		"if (x) {};",
+		"function() {}();",
+		"let m = macro(a, b) { quote(unquote(b) - unquote(a)) }; m(1, 2);",
+		`import "lib/list"; export let x = 1;`,
+		`let h = {"a": 1, true: [1, 2], 3: "${x}-${y + 1}"}; h["a"];`,
+		"[1, 2, 3][1:]; [1][:x]; [1][:]; [1, 2][0:1];",
+		"!-(1 * (2 - 3)) / 4 == 5 != 6 > 7;",
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+
+		data, err := MarshalIndent(program, "", "\t")
+		if err != nil {
+			t.Fatalf("%q: Marshal failed: %s", input, err)
+		}
+
+		node, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%q: Unmarshal failed: %s\n%s", input, err, data)
+		}
+
+		if !reflect.DeepEqual(node, program) {
+			t.Errorf("%q: tree changed.\nwant=%s\ngot =%s", input, program, node)
+		}
+	}
+}
+
+func TestRoundTripGeneratedPrograms(t *testing.T) {
+	seeds := 200
+	if testing.Short() {
+		seeds = 20
+	}
+
+	for seed := 0; seed < seeds; seed++ {
+		program := difftest.NewGenerator(int64(seed)).Program()
+
+		data, err := Marshal(program)
+		if err != nil {
+			t.Fatalf("seed %d: Marshal failed: %s", seed, err)
+		}
+
+		node, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("seed %d: Unmarshal failed: %s", seed, err)
+		}
+
+		if !reflect.DeepEqual(node, program) {
+			t.Fatalf("seed %d: tree changed.\nwant=%s\ngot =%s", seed, program, node)
+		}
+	}
+}
+
+// TestUnmarshalWithoutTokens checks that a program written by hand, without
+// tokens, runs like its source.
+func TestUnmarshalWithoutTokens(t *testing.T) {
+	data := `{"type": "Program", "statements": [
+		{"type": "LetStatement",
+			"name": {"type": "Identifier", "value": "double"},
+			"value": {"type": "FunctionLiteral",
+				"parameters": [{"type": "Identifier", "value": "x"}],
+				"body": {"type": "BlockStatement", "statements": [
+					{"type": "ExpressionStatement", "expression": {"type": "InfixExpression",
+						"left": {"type": "Identifier", "value": "x"},
+						"operator": "*",
+						"right": {"type": "IntegerLiteral", "value": 2}}}]}}},
+		{"type": "ExpressionStatement", "expression": {"type": "CallExpression",
+			"function": {"type": "Identifier", "value": "double"},
+			"arguments": [{"type": "IntegerLiteral", "value": 21}]}}]}`
+
+	node, err := Unmarshal([]byte(data))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+
+	program := node.(*ast.Program)
+
+	want := difftest.Evaluate(parse(t, "let double = function(x) { x * 2 }; double(21);"))
+	if want.String() != "42" {
+		t.Fatalf("wrong result of the source: %s", want)
+	}
+
+	if got := difftest.Evaluate(program); got.String() != want.String() {
+		t.Errorf("evaluator: want=%s, got=%s", want, got)
+	}
+
+	if err := difftest.Check(program); err != nil {
+		t.Errorf("compiler: %s", err)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{``, "want an object, got nothing"},
+		{`{"type": `, "unexpected end of JSON input"},
+		{`null`, "missing node"},
+		{`[]`, "want an object, got []"},
+		{`{}`, "type: missing value"},
+		{`{"type": "Loop"}`, `type: unknown node type "Loop"`},
+		{`{"type": "Program", "token": {}}`, `unknown field "token"`},
+		{`{"type": "Program", "statements": [null]}`, "statements[0]: missing node"},
+		{`{"type": "Program", "statements": [{"type": "Boolean", "value": true}]}`,
+			"statements[0]: want a statement, got Boolean"},
+		{`{"type": "ExpressionStatement"}`, "expression: missing node"},
+		{`{"type": "ExpressionStatement", "expression": {"type": "ReturnStatement", "returnValue": {"type": "Boolean", "value": true}}}`,
+			"expression: want an expression, got ReturnStatement"},
+		{`{"type": "Identifier", "value": 1}`,
+			"value: want string, got 1"},
+		{`{"type": "Identifier", "value": "x", "token": {"type": "Identifier", "kind": 1}}`,
+			`token: json: unknown field "kind"`},
+		{`{"type": "IntegerLiteral", "value": 1.5}`,
+			"value: want int64, got 1.5"},
+		{`{"type": "Boolean", "value": true, "extra": 1}`, `unknown field "extra"`},
+		{`{"type": "LetStatement", "name": {"type": "StringLiteral", "value": "x"}, "value": {"type": "Boolean", "value": true}}`,
+			"name: want Identifier, got StringLiteral"},
+		{`{"type": "InfixExpression", "left": {"type": "Boolean", "value": true}, "operator": "+"}`,
+			"right: missing node"},
+		{`{"type": "ExportStatement", "statement": {"type": "ReturnStatement", "returnValue": {"type": "Boolean", "value": true}}}`,
+			"statement: want LetStatement, got ReturnStatement"},
+		{`{"type": "ImportStatement"}`, "path: missing value"},
+		{`{"type": "IfExpression", "condition": {"type": "Boolean", "value": true}, "consequence": {"type": "Boolean", "value": true}}`,
+			"consequence: want BlockStatement, got Boolean"},
+		{`{"type": "FunctionLiteral", "parameters": [{"type": "Boolean", "value": true}], "body": {"type": "BlockStatement"}}`,
+			"parameters[0]: want Identifier, got Boolean"},
+		{`{"type": "FunctionLiteral", "parameters": []}`, "body: missing node"},
+		{`{"type": "HashLiteral", "pairs": [{"key": {"type": "Boolean", "value": true}}]}`,
+			"pairs[0].value: missing node"},
+		{`{"type": "HashLiteral", "pairs": [{"key": {"type": "Boolean", "value": true}, "value": {"type": "Boolean", "value": true}, "v": 1}]}`,
+			`pairs[0]: unknown field "v"`},
+		{`{"type": "ArrayLiteral", "elements": {}}`,
+			"elements: want an array, got {}"},
+		{`{"type": "StringLiteral", "value": ["a very long list", 1]}`,
+			`value: want string, got ["a very long list",...`},
+		{`{"type": "Program", "statements": [{"type": "ExpressionStatement", "expression": {"type": "CallExpression",
+			"function": {"type": "Identifier", "value": "f"}, "arguments": [{"type": "Loop"}]}}]}`,
+			`statements[0].expression.arguments[0].type: unknown node type "Loop"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Unmarshal([]byte(tt.input))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error.\nwant=%q\ngot =%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %s", input, strings.Join(p.Errors(), "; "))
+	}
+
+	return program
+}
@@ -0,0 +1,558 @@
+package astjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gocompiler/ast"
+	"gocompiler/token"
+)
+
+// Unmarshal rebuilds the node encoded in data. Errors name the path to the
+// offending value, such as statements[0].value.right.
+func Unmarshal(data []byte) (ast.Node, error) {
+	node, err := decodeNode(data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if node == nil {
+		return nil, fmt.Errorf("missing node")
+	}
+
+	return node, nil
+}
+
+// members are the fields of a JSON object at path, which is empty for the
+// outermost one. Lookups mark the fields as used, so that fields that aren't
+// part of a node can be rejected.
+type members struct {
+	path   string
+	fields map[string]json.RawMessage
+	used   map[string]bool
+}
+
+// decodeMembers decodes the object in data. It returns nil for null.
+func decodeMembers(data []byte, path string) (*members, error) {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil, nil
+	}
+
+	if len(data) == 0 || data[0] != '{' {
+		return nil, pathError(path, "want an object, got %s", abbreviate(data))
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, pathError(path, "%s", err)
+	}
+
+	return &members{path: path, fields: fields, used: map[string]bool{}}, nil
+}
+
+func (m *members) at(key string) string {
+	if m.path == "" {
+		return key
+	}
+
+	return m.path + "." + key
+}
+
+// raw returns the field key, or nil if it is missing or null.
+func (m *members) raw(key string) json.RawMessage {
+	m.used[key] = true
+
+	data := m.fields[key]
+	if data == nil || string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+
+	return data
+}
+
+func (m *members) value(key string, v interface{}) error {
+	data := m.raw(key)
+	if data == nil {
+		return pathError(m.at(key), "missing value")
+	}
+
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return pathError(m.at(key), "want %s, got %s", reflect.TypeOf(v).Elem(), abbreviate(data))
+	}
+
+	return nil
+}
+
+// unused returns an error for the first field, in sorted order, that no
+// lookup asked for.
+func (m *members) unused() error {
+	var keys []string
+	for key := range m.fields {
+		if !m.used[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sort.Strings(keys)
+	return pathError(m.path, "unknown field %q", keys[0])
+}
+
+func (m *members) node(key string, required bool) (ast.Node, error) {
+	node, err := decodeNode(m.raw(key), m.at(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if node == nil && required {
+		return nil, pathError(m.at(key), "missing node")
+	}
+
+	return node, nil
+}
+
+func (m *members) expression(key string, required bool) (ast.Expression, error) {
+	node, err := m.node(key, required)
+	if err != nil || node == nil {
+		return nil, err
+	}
+
+	return toExpression(node, m.at(key))
+}
+
+func (m *members) block(key string, required bool) (*ast.BlockStatement, error) {
+	node, err := m.node(key, required)
+	if err != nil || node == nil {
+		return nil, err
+	}
+
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		return nil, pathError(m.at(key), "want BlockStatement, got %s", typeName(node))
+	}
+
+	return block, nil
+}
+
+func (m *members) let(key string) (*ast.LetStatement, error) {
+	node, err := m.node(key, true)
+	if err != nil {
+		return nil, err
+	}
+
+	let, ok := node.(*ast.LetStatement)
+	if !ok {
+		return nil, pathError(m.at(key), "want LetStatement, got %s", typeName(node))
+	}
+
+	return let, nil
+}
+
+func (m *members) identifier(key string) (*ast.Identifier, error) {
+	node, err := m.node(key, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return toIdentifier(node, m.at(key))
+}
+
+// list returns the elements of the array field key, and the path of each. A
+// missing or null array gives nil, an empty one an empty slice.
+func (m *members) list(key string) ([]json.RawMessage, []string, error) {
+	data := m.raw(key)
+	if data == nil {
+		return nil, nil, nil
+	}
+
+	if data[0] != '[' {
+		return nil, nil, pathError(m.at(key), "want an array, got %s", abbreviate(data))
+	}
+
+	var elements []json.RawMessage
+	err := json.Unmarshal(data, &elements)
+	if err != nil {
+		return nil, nil, pathError(m.at(key), "%s", err)
+	}
+
+	paths := make([]string, len(elements))
+	for i := range elements {
+		paths[i] = fmt.Sprintf("%s[%d]", m.at(key), i)
+	}
+
+	return elements, paths, nil
+}
+
+func (m *members) statements(key string) ([]ast.Statement, error) {
+	elements, paths, err := m.list(key)
+	if err != nil || elements == nil {
+		return nil, err
+	}
+
+	statements := []ast.Statement{}
+	for i, data := range elements {
+		node, err := decodeRequired(data, paths[i])
+		if err != nil {
+			return nil, err
+		}
+
+		stmt, ok := node.(ast.Statement)
+		if !ok {
+			return nil, pathError(paths[i], "want a statement, got %s", typeName(node))
+		}
+
+		statements = append(statements, stmt)
+	}
+
+	return statements, nil
+}
+
+func (m *members) expressions(key string) ([]ast.Expression, error) {
+	elements, paths, err := m.list(key)
+	if err != nil || elements == nil {
+		return nil, err
+	}
+
+	expressions := []ast.Expression{}
+	for i, data := range elements {
+		node, err := decodeRequired(data, paths[i])
+		if err != nil {
+			return nil, err
+		}
+
+		exp, err := toExpression(node, paths[i])
+		if err != nil {
+			return nil, err
+		}
+
+		expressions = append(expressions, exp)
+	}
+
+	return expressions, nil
+}
+
+func (m *members) identifiers(key string) ([]*ast.Identifier, error) {
+	elements, paths, err := m.list(key)
+	if err != nil || elements == nil {
+		return nil, err
+	}
+
+	identifiers := []*ast.Identifier{}
+	for i, data := range elements {
+		node, err := decodeRequired(data, paths[i])
+		if err != nil {
+			return nil, err
+		}
+
+		ident, err := toIdentifier(node, paths[i])
+		if err != nil {
+			return nil, err
+		}
+
+		identifiers = append(identifiers, ident)
+	}
+
+	return identifiers, nil
+}
+
+func (m *members) pairs(key string) ([]ast.HashPair, error) {
+	elements, paths, err := m.list(key)
+	if err != nil || elements == nil {
+		return nil, err
+	}
+
+	pairs := []ast.HashPair{}
+	for i, data := range elements {
+		pair, err := decodeMembers(data, paths[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if pair == nil {
+			return nil, pathError(paths[i], "missing pair")
+		}
+
+		k, err := pair.expression("key", true)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := pair.expression("value", true)
+		if err != nil {
+			return nil, err
+		}
+
+		err = pair.unused()
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, ast.HashPair{Key: k, Value: v})
+	}
+
+	return pairs, nil
+}
+
+func (m *members) token() (token.Token, error) {
+	data := m.raw("token")
+	if data == nil {
+		return token.Token{}, nil
+	}
+
+	var tok struct {
+		Type     string `json:"type"`
+		Literal  string `json:"literal"`
+		Position struct {
+			Line   int `json:"line"`
+			Column int `json:"column"`
+		} `json:"position"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&tok)
+	if err != nil {
+		return token.Token{}, pathError(m.at("token"), "%s", err)
+	}
+
+	return token.Token{
+		Type:     token.TokenType(tok.Type),
+		Literal:  tok.Literal,
+		Position: token.Position{Line: tok.Position.Line, Column: tok.Position.Column},
+	}, nil
+}
+
+func decodeRequired(data json.RawMessage, path string) (ast.Node, error) {
+	node, err := decodeNode(data, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if node == nil {
+		return nil, pathError(path, "missing node")
+	}
+
+	return node, nil
+}
+
+// decodeNode decodes the node at path. It returns nil for null.
+func decodeNode(data json.RawMessage, path string) (ast.Node, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	m, err := decodeMembers(data, path)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	var typ string
+	err = m.value("type", &typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var tok token.Token
+	if typ != "Program" {
+		tok, err = m.token()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var node ast.Node
+
+	switch typ {
+	case "Program":
+		n := &ast.Program{}
+		n.Statements, err = m.statements("statements")
+		node = n
+	case "BlockStatement":
+		n := &ast.BlockStatement{Token: tok}
+		n.Statements, err = m.statements("statements")
+		node = n
+	case "ExpressionStatement":
+		n := &ast.ExpressionStatement{Token: tok}
+		n.Expression, err = m.expression("expression", true)
+		node = n
+	case "LetStatement":
+		n := &ast.LetStatement{Token: tok}
+		n.Name, err = m.identifier("name")
+		if err == nil {
+			n.Value, err = m.expression("value", true)
+		}
+		node = n
+	case "ReturnStatement":
+		n := &ast.ReturnStatement{Token: tok}
+		n.ReturnValue, err = m.expression("returnValue", true)
+		node = n
+	case "ImportStatement":
+		n := &ast.ImportStatement{Token: tok}
+		err = m.value("path", &n.Path)
+		node = n
+	case "ExportStatement":
+		n := &ast.ExportStatement{Token: tok}
+		n.Statement, err = m.let("statement")
+		node = n
+	case "Identifier":
+		n := &ast.Identifier{Token: tok}
+		err = m.value("value", &n.Value)
+		node = n
+	case "Boolean":
+		n := &ast.Boolean{Token: tok}
+		err = m.value("value", &n.Value)
+		node = n
+	case "IntegerLiteral":
+		n := &ast.IntegerLiteral{Token: tok}
+		err = m.value("value", &n.Value)
+		node = n
+	case "StringLiteral":
+		n := &ast.StringLiteral{Token: tok}
+		err = m.value("value", &n.Value)
+		node = n
+	case "InterpolatedString":
+		n := &ast.InterpolatedString{Token: tok}
+		n.Parts, err = m.expressions("parts")
+		node = n
+	case "PrefixExpression":
+		n := &ast.PrefixExpression{Token: tok}
+		err = m.value("operator", &n.Operator)
+		if err == nil {
+			n.Right, err = m.expression("right", true)
+		}
+		node = n
+	case "InfixExpression":
+		n := &ast.InfixExpression{Token: tok}
+		n.Left, err = m.expression("left", true)
+		if err == nil {
+			err = m.value("operator", &n.Operator)
+		}
+		if err == nil {
+			n.Right, err = m.expression("right", true)
+		}
+		node = n
+	case "IfExpression":
+		n := &ast.IfExpression{Token: tok}
+		n.Condition, err = m.expression("condition", true)
+		if err == nil {
+			n.Consequence, err = m.block("consequence", true)
+		}
+		if err == nil {
+			n.Alternative, err = m.block("alternative", false)
+		}
+		node = n
+	case "FunctionLiteral":
+		n := &ast.FunctionLiteral{Token: tok}
+		n.Parameters, err = m.identifiers("parameters")
+		if err == nil {
+			n.Body, err = m.block("body", true)
+		}
+		node = n
+	case "MacroLiteral":
+		n := &ast.MacroLiteral{Token: tok}
+		n.Parameters, err = m.identifiers("parameters")
+		if err == nil {
+			n.Body, err = m.block("body", true)
+		}
+		node = n
+	case "CallExpression":
+		n := &ast.CallExpression{Token: tok}
+		n.Function, err = m.expression("function", true)
+		if err == nil {
+			n.Arguments, err = m.expressions("arguments")
+		}
+		node = n
+	case "ArrayLiteral":
+		n := &ast.ArrayLiteral{Token: tok}
+		n.Elements, err = m.expressions("elements")
+		node = n
+	case "HashLiteral":
+		n := &ast.HashLiteral{Token: tok}
+		n.Pairs, err = m.pairs("pairs")
+		node = n
+	case "IndexExpression":
+		n := &ast.IndexExpression{Token: tok}
+		n.Left, err = m.expression("left", true)
+		if err == nil {
+			n.Index, err = m.expression("index", true)
+		}
+		node = n
+	case "SliceExpression":
+		n := &ast.SliceExpression{Token: tok}
+		n.Left, err = m.expression("left", true)
+		if err == nil {
+			n.Low, err = m.expression("low", false)
+		}
+		if err == nil {
+			n.High, err = m.expression("high", false)
+		}
+		node = n
+	default:
+		return nil, pathError(m.at("type"), "unknown node type %q", typ)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.unused()
+	if err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func toExpression(node ast.Node, path string) (ast.Expression, error) {
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		return nil, pathError(path, "want an expression, got %s", typeName(node))
+	}
+
+	return exp, nil
+}
+
+func toIdentifier(node ast.Node, path string) (*ast.Identifier, error) {
+	ident, ok := node.(*ast.Identifier)
+	if !ok {
+		return nil, pathError(path, "want Identifier, got %s", typeName(node))
+	}
+
+	return ident, nil
+}
+
+// typeName returns the name of the type of node, as in the "type" field.
+func typeName(node ast.Node) string {
+	return fmt.Sprintf("%T", node)[len("*ast."):]
+}
+
+// abbreviate returns data for an error message, shortened if it is long.
+func abbreviate(data []byte) string {
+	if len(data) == 0 {
+		return "nothing"
+	}
+
+	if len(data) > 20 {
+		return string(data[:20]) + "..."
+	}
+
+	return string(data)
+}
+
+func pathError(path string, format string, args ...interface{}) error {
+	if path == "" {
+		return fmt.Errorf(format, args...)
+	}
+
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gocompiler/format"
+)
+
+const sourceFileSuffix = ".mk"
+
+// fmtCommand formats the source files under the paths in args, or standard
+// input if there are none, and returns the exit status.
+func fmtCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result to the file instead of standard output")
+	list := flags.Bool("l", false, "list the files whose formatting differs")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "gocompiler fmt: cannot use -w with standard input")
+			return 2
+		}
+
+		src, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "gocompiler fmt: %s\n", err)
+			return 1
+		}
+
+		formatted, err := format.Source(src)
+		if err != nil {
+			reportFormatError(stderr, "<standard input>", err)
+			return 1
+		}
+
+		stdout.Write(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		files, err := findFiles(path, sourceFileSuffix)
+		if err != nil {
+			fmt.Fprintf(stderr, "gocompiler fmt: %s\n", err)
+			status = 1
+			continue
+		}
+
+		for _, file := range files {
+			err := formatFile(file, *write, *list, stdout)
+			if err != nil {
+				reportFormatError(stderr, file, err)
+				status = 1
+			}
+		}
+	}
+
+	return status
+}
+
+// formatFile formats file. Without write or list, the result goes to w.
+func formatFile(file string, write, list bool, w io.Writer) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(src)
+	if err != nil {
+		return err
+	}
+
+	changed := !bytes.Equal(src, formatted)
+
+	if list && changed {
+		fmt.Fprintln(w, file)
+	}
+
+	if write && changed {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(file, formatted, info.Mode().Perm())
+	}
+
+	if !write && !list {
+		_, err = w.Write(formatted)
+	}
+
+	return err
+}
+
+// reportFormatError prints err, which may hold several parser errors, with
+// one line per error.
+func reportFormatError(w io.Writer, file string, err error) {
+	for _, msg := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(w, "%s: %s\n", file, msg)
+	}
+}
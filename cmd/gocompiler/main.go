@@ -0,0 +1,111 @@
+// Command gocompiler is the command line tool for the language.
+//
+// Usage:
+//
+//	gocompiler fmt [-l] [-w] [path ...]
+//	gocompiler parse [-d] [file]
+//	gocompiler test [path ...]
+//
+// The fmt command prints the .mk files found under each path in canonical
+// form, as the format package does. With -l it lists the files whose
+// formatting differs instead, and with -w it rewrites them. Without paths it
+// formats standard input.
+//
+// The parse command prints the syntax tree of a source file, or of standard
+// input, as JSON in the format of the astjson package. With -d it reads such
+// a tree instead and prints it as formatted source, so that programs built by
+// other tools can be run like any other.
+//
+// The test command runs the tests in the *_test.mk files found under each
+// path, or under the current directory if no path is given. A test is a
+// top-level function whose name starts with test_, such as
+//
+//	let test_add = function() {
+//		assert_eq(1 + 2, 3);
+//	};
+//
+// Tests check their results with the builtins assert, assert_eq and
+// assert_error. Macros defined by top-level let statements are expanded
+// before the tests are compiled. Test files may import modules, which are
+// looked up next to the importing file and then in the directories listed in
+// the MKPATH environment variable, as the module package does. Tests may
+// import and read, with read_file, the files under the directory of the test
+// file and under the MKPATH directories; read_file names are relative to the
+// directory of the test file. The command
+// reports every test as passed or failed, with the position of the failure,
+// and exits with status 1 if any test failed.
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command given by args and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	switch args[0] {
+	case "fmt":
+		return fmtCommand(args[1:], stdin, stdout, stderr)
+	case "parse":
+		return parseCommand(args[1:], stdin, stdout, stderr)
+	case "test":
+		return testCommand(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "gocompiler: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gocompiler <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  fmt [-l] [-w] [path ...]  format .mk files")
+	fmt.Fprintln(w, "  parse [-d] [file]         print the syntax tree of a .mk file as JSON")
+	fmt.Fprintln(w, "  test [path ...]           run the test_ functions of *_test.mk files")
+}
+
+// findFiles returns path if it is a file, or the files under it whose names
+// end with suffix if it is a directory.
+func findFiles(path, suffix string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() && strings.HasSuffix(path, suffix) {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTestCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		status   int
+		expected []string
+	}{
+		{
+			args:   []string{"test", filepath.Join("testdata", "passing")},
+			status: 0,
+			expected: []string{
+				"--- PASS: test_macros (testdata/passing/macros_test.mk:13:5)",
+				"--- PASS: test_double (testdata/passing/math_test.mk:3:5)",
+				"--- PASS: test_errors (testdata/passing/math_test.mk:8:5)",
+				"--- PASS: test_modules (testdata/passing/modules_test.mk:3:5)",
+				"--- PASS: test_interpolation (testdata/passing/strings_test.mk:1:5)",
+				"5 passed, 0 failed",
+			},
+		},
+		{
+			args:   []string{"test", filepath.Join("testdata", "failing", "failing_test.mk")},
+			status: 1,
+			expected: []string{
+				"--- PASS: test_passes (testdata/failing/failing_test.mk:3:5)",
+				"--- FAIL: test_assert_eq (testdata/failing/failing_test.mk:7:5)",
+				"    testdata/failing/failing_test.mk:8:11: assertion failed: got 2, want 3",
+				"--- FAIL: test_runtime_error (testdata/failing/failing_test.mk:11:5)",
+				"    testdata/failing/failing_test.mk:13:9: unsupported types for binary operation: Array Integer",
+				"--- FAIL: test_module_error (testdata/failing/failing_test.mk:16:5)",
+				"    testdata/failing/lib/divide.mk:2:4: division by zero",
+				"1 passed, 3 failed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		status := run(tt.args, nil, &stdout, &stderr)
+		if status != tt.status {
+			t.Errorf("%v: wrong exit status. want=%d, got=%d (stderr %q)", tt.args, tt.status, status, stderr.String())
+		}
+
+		lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+		if strings.Join(lines, "\n") != filepath.FromSlash(strings.Join(tt.expected, "\n")) {
+			t.Errorf("%v: wrong output.\nwant:\n%s\ngot:\n%s", tt.args, strings.Join(tt.expected, "\n"), stdout.String())
+		}
+	}
+}
+
+func TestTestCommandErrors(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"let test_a = function() { 1 +; };", "--- FAIL: %s\n    %s: no prefix parse function for ; found\n0 passed, 1 failed\n"},
+		{"let x = y;", "--- FAIL: %s\n    %s: undefined variable y\n0 passed, 1 failed\n"},
+		{"let x = 1 / 0;", "--- FAIL: %s\n    %s:1:11: division by zero\n0 passed, 1 failed\n"},
+		{"let m = macro() { 1 }; m();", "--- FAIL: %s\n    %s: expanding macro m at line 1, column 25: want a quote as result, got Integer\n0 passed, 1 failed\n"},
+		{`import "missing";`, "--- FAIL: %s\n    %s: import \"missing\": cannot find module missing.mk\n0 passed, 1 failed\n"},
+		{`import "../missing";`, "--- FAIL: %s\n    %s: import \"../missing\": cannot find module ../missing.mk\n0 passed, 1 failed\n"},
+		{"return 1;", "--- FAIL: %s\n    %s: returned before running its tests\n0 passed, 1 failed\n"},
+		{"let test_a = function() { 1 }; return [1, 2];", "--- FAIL: %s\n    %s: returned before running its tests\n0 passed, 1 failed\n"},
+		{`read_file("/etc/passwd");`, "--- FAIL: %s\n    %s:1:10: cannot read /etc/passwd: invalid argument\n0 passed, 1 failed\n"},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "broken_test.mk")
+
+		err := ioutil.WriteFile(file, []byte(tt.source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+
+		status := run([]string{"test", file}, nil, &stdout, &stderr)
+		if status != 1 {
+			t.Errorf("%q: wrong exit status. want=1, got=%d", tt.source, status)
+		}
+
+		expected := fmt.Sprintf(tt.expected, file, file)
+		if stdout.String() != expected {
+			t.Errorf("%q: wrong output.\nwant:\n%s\ngot:\n%s", tt.source, expected, stdout.String())
+		}
+	}
+}
+
+func TestTestCommandSearchPath(t *testing.T) {
+	lib, err := filepath.Abs(filepath.Join("testdata", "passing", "lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MKPATH", strings.Join([]string{t.TempDir(), lib}, string(filepath.ListSeparator)))
+
+	file := filepath.Join(t.TempDir(), "greet_test.mk")
+	source := `import "greet"; let test_greet = function() { assert_eq(greet("you"), "hello, you") };`
+
+	err = ioutil.WriteFile(file, []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	status := run([]string{"test", file}, nil, &stdout, &stderr)
+	if status != 0 {
+		t.Errorf("wrong exit status. want=0, got=%d\n%s", status, stdout.String())
+	}
+
+	if !strings.HasSuffix(stdout.String(), "1 passed, 0 failed\n") {
+		t.Errorf("wrong output:\n%s", stdout.String())
+	}
+}
+
+func TestTestFS(t *testing.T) {
+	root, lib := t.TempDir(), t.TempDir()
+
+	for file, dir := range map[string]string{"data.txt": root, "greet.mk": lib} {
+		err := ioutil.WriteFile(filepath.Join(dir, file), []byte(file), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("MKPATH", strings.Join([]string{"", lib}, string(filepath.ListSeparator)))
+
+	fsys := newTestFS(filepath.Join(root, "main_test.mk"))
+
+	if search := fsys.searchPath(); len(search) != 1 || search[0] != "MKPATH/0" {
+		t.Errorf("wrong search path: %q", search)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"data.txt", "data.txt"},
+		{"MKPATH/0/greet.mk", "greet.mk"},
+		{"MKPATH/1/greet.mk", ""},
+		{"greet.mk", ""},
+		{"../data.txt", ""},
+		{filepath.ToSlash(filepath.Join(root, "data.txt")), ""},
+	}
+
+	for _, tt := range tests {
+		data, err := fs.ReadFile(fsys, tt.name)
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+
+		if err != nil || string(data) != tt.expected {
+			t.Errorf("%s: wrong file. want=%q, got=%q (%v)", tt.name, tt.expected, data, err)
+		}
+	}
+
+	if path := fsys.hostPath("MKPATH/0/greet.mk"); path != filepath.Join(lib, "greet.mk") {
+		t.Errorf("wrong host path: %s", path)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := run([]string{"bogus"}, nil, &stdout, &stderr)
+	if status != 2 {
+		t.Errorf("wrong exit status. want=2, got=%d", status)
+	}
+
+	if !strings.HasPrefix(stderr.String(), `gocompiler: unknown command "bogus"`) {
+		t.Errorf("wrong error: %q", stderr.String())
+	}
+}
+
+func TestFmtCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := run([]string{"fmt"}, strings.NewReader("let x=1+2"), &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("wrong exit status. want=0, got=%d (stderr %q)", status, stderr.String())
+	}
+
+	if stdout.String() != "let x = 1 + 2;\n" {
+		t.Errorf("wrong output: %q", stdout.String())
+	}
+
+	dir := t.TempDir()
+	messy := filepath.Join(dir, "messy.mk")
+	tidy := filepath.Join(dir, "tidy.mk")
+
+	for file, source := range map[string]string{messy: "f( 1 )", tidy: "f(1);\n"} {
+		err := ioutil.WriteFile(file, []byte(source), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout.Reset()
+
+	status = run([]string{"fmt", "-l", dir}, nil, &stdout, &stderr)
+	if status != 0 || stdout.String() != messy+"\n" {
+		t.Errorf("fmt -l: wrong result. status=%d, output=%q", status, stdout.String())
+	}
+
+	stdout.Reset()
+
+	status = run([]string{"fmt", "-w", dir}, nil, &stdout, &stderr)
+	if status != 0 || stdout.String() != "" {
+		t.Errorf("fmt -w: wrong result. status=%d, output=%q", status, stdout.String())
+	}
+
+	source, err := ioutil.ReadFile(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(source) != "f(1);\n" {
+		t.Errorf("fmt -w: file not rewritten: %q", source)
+	}
+}
+
+func TestFmtCommandErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := run([]string{"fmt"}, strings.NewReader("let = 1;"), &stdout, &stderr)
+	if status != 1 {
+		t.Errorf("wrong exit status. want=1, got=%d", status)
+	}
+
+	expected := "<standard input>: expected next token to be Identifier, got = instead\n" +
+		"<standard input>: no prefix parse function for = found\n"
+	if stderr.String() != expected {
+		t.Errorf("wrong errors.\nwant:\n%s\ngot:\n%s", expected, stderr.String())
+	}
+
+	stderr.Reset()
+
+	status = run([]string{"fmt", "-w"}, strings.NewReader("1"), &stdout, &stderr)
+	if status != 2 {
+		t.Errorf("fmt -w on standard input: wrong exit status. want=2, got=%d", status)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	status := run([]string{"parse"}, strings.NewReader("f(1)"), &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("wrong exit status. want=0, got=%d (stderr %q)", status, stderr.String())
+	}
+
+	if !strings.HasPrefix(stdout.String(), "{\n\t\"type\": \"Program\",\n\t\"statements\": [\n") {
+		t.Errorf("wrong output: %q", stdout.String())
+	}
+
+	tree := stdout.String()
+	stdout.Reset()
+
+	status = run([]string{"parse", "-d"}, strings.NewReader(tree), &stdout, &stderr)
+	if status != 0 || stdout.String() != "f(1);\n" {
+		t.Errorf("parse -d: wrong result. status=%d, output=%q, stderr=%q", status, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+
+	status = run([]string{"parse", "-d"}, strings.NewReader(`{"type": "IntegerLiteral", "value": 7}`), &stdout, &stderr)
+	if status != 0 || stdout.String() != "7\n" {
+		t.Errorf("parse -d on an expression: wrong result. status=%d, output=%q", status, stdout.String())
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		input    string
+		status   int
+		expected string
+	}{
+		{[]string{"parse"}, "let = 1;", 1, "<standard input>: expected next token to be Identifier, got = instead\n" +
+			"<standard input>: no prefix parse function for = found\n"},
+		{[]string{"parse", "-d"}, `{"type": "Program", "statements": [1]}`, 1,
+			"<standard input>: statements[0]: want an object, got 1\n"},
+		{[]string{"parse", "a.mk", "b.mk"}, "", 2, "gocompiler parse: too many arguments\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		status := run(tt.args, strings.NewReader(tt.input), &stdout, &stderr)
+		if status != tt.status {
+			t.Errorf("%v: wrong exit status. want=%d, got=%d", tt.args, tt.status, status)
+		}
+
+		if stderr.String() != tt.expected {
+			t.Errorf("%v: wrong errors.\nwant:\n%s\ngot:\n%s", tt.args, tt.expected, stderr.String())
+		}
+	}
+}
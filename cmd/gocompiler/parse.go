@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"gocompiler/ast"
+	"gocompiler/astjson"
+	"gocompiler/format"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+)
+
+// parseCommand prints the syntax tree of the source file in args, or of
+// standard input, as JSON. With -d it does the reverse and prints the tree
+// in a JSON file as source. It returns the exit status.
+func parseCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	decode := flags.Bool("d", false, "read a syntax tree as JSON and print it as source")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	if flags.NArg() > 1 {
+		fmt.Fprintln(stderr, "gocompiler parse: too many arguments")
+		return 2
+	}
+
+	name := "<standard input>"
+	var input []byte
+	if flags.NArg() == 0 {
+		input, err = ioutil.ReadAll(stdin)
+	} else {
+		name = flags.Arg(0)
+		input, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gocompiler parse: %s\n", err)
+		return 1
+	}
+
+	if *decode {
+		node, err := astjson.Unmarshal(input)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", name, err)
+			return 1
+		}
+
+		io.WriteString(stdout, format.Node(node))
+		if _, ok := node.(ast.Expression); ok {
+			io.WriteString(stdout, "\n")
+		}
+
+		return 0
+	}
+
+	p := parser.New(lexer.New(string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(stderr, "%s: %s\n", name, msg)
+		}
+		return 1
+	}
+
+	data, err := astjson.MarshalIndent(program, "", "\t")
+	if err != nil {
+		fmt.Fprintf(stderr, "gocompiler parse: %s\n", err)
+		return 1
+	}
+
+	stdout.Write(data)
+	io.WriteString(stdout, "\n")
+
+	return 0
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gocompiler/ast"
+	"gocompiler/compiler"
+	"gocompiler/eval"
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/module"
+	"gocompiler/parser"
+	"gocompiler/token"
+	"gocompiler/vm"
+)
+
+const (
+	testFileSuffix = "_test.mk"
+	testPrefix     = "test_"
+)
+
+// testCase is a test function found in a test file.
+type testCase struct {
+	name     string
+	position token.Position
+}
+
+// testCommand runs the tests under paths and returns the exit status.
+func testCommand(paths []string, stdout, stderr io.Writer) int {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var files []string
+	for _, path := range paths {
+		found, err := findFiles(path, testFileSuffix)
+		if err != nil {
+			fmt.Fprintf(stderr, "gocompiler test: %s\n", err)
+			return 1
+		}
+
+		files = append(files, found...)
+	}
+
+	if len(files) == 0 {
+		fmt.Fprintln(stdout, "no test files")
+		return 0
+	}
+
+	passed, failed := 0, 0
+	for _, file := range files {
+		p, f := runTestFile(file, stdout)
+		passed += p
+		failed += f
+	}
+
+	fmt.Fprintf(stdout, "%d passed, %d failed\n", passed, failed)
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// runTestFile runs the tests in file, reports them to w and returns how many
+// passed and failed. A file that doesn't compile or whose top-level code
+// fails counts as one failure.
+func runTestFile(file string, w io.Writer) (int, int) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(w, "--- FAIL: %s\n    %s\n", file, err)
+		return 0, 1
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(w, "--- FAIL: %s\n", file)
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(w, "    %s: %s\n", file, msg)
+		}
+		return 0, 1
+	}
+
+	env := ir.NewEnvironment()
+	eval.DefineMacros(program, env)
+
+	expanded, err := eval.ExpandMacros(program, env)
+	if err != nil {
+		fmt.Fprintf(w, "--- FAIL: %s\n    %s: %s\n", file, file, err)
+		return 0, 1
+	}
+
+	program = expanded.(*ast.Program)
+	tests := findTests(program)
+
+	// The program ends with an array of the test functions, so that they
+	// are the result the VM leaves behind.
+	program.Statements = append(program.Statements, testArray(tests))
+
+	fsys := newTestFS(file)
+	loader := &module.Loader{FS: fsys, Main: filepath.Base(file), SearchPath: fsys.searchPath()}
+
+	comp := compiler.NewWithOptions(compiler.Options{Loader: loader, File: loader.Main})
+
+	err = comp.Compile(program)
+	if err != nil {
+		fmt.Fprintf(w, "--- FAIL: %s\n    %s: %s\n", file, file, err)
+		return 0, 1
+	}
+
+	machine := vm.NewWithConfig(comp.Bytecode(), vm.Config{FS: fsys})
+
+	err = machine.Run()
+	if err != nil {
+		fmt.Fprintf(w, "--- FAIL: %s\n    %s\n", file, failure(fsys, file, token.Position{}, err))
+		return 0, 1
+	}
+
+	// A top-level return ends the program before the array of tests, with
+	// its own value as the result.
+	functions, ok := machine.LastPoppedStackElem().(*ir.Array)
+	if !ok || len(functions.Elements) != len(tests) {
+		fmt.Fprintf(w, "--- FAIL: %s\n    %s: returned before running its tests\n", file, file)
+		return 0, 1
+	}
+
+	passed, failed := 0, 0
+	for i, test := range tests {
+		_, err := machine.Call(functions.Elements[i])
+		if err != nil {
+			fmt.Fprintf(w, "--- FAIL: %s (%s)\n", test.name, location(file, test.position))
+			fmt.Fprintf(w, "    %s\n", failure(fsys, file, test.position, err))
+			failed++
+			continue
+		}
+
+		fmt.Fprintf(w, "--- PASS: %s (%s)\n", test.name, location(file, test.position))
+		passed++
+	}
+
+	return passed, failed
+}
+
+// searchMount is the directory of testFS under which the directories of
+// MKPATH are mounted, by their index.
+const searchMount = "MKPATH"
+
+// testFS gives a test file, which is trusted, the files in its directory and
+// in the directories of MKPATH. The directory of the test file is the root,
+// and the i-th directory of MKPATH is mounted at MKPATH/i, ahead of anything
+// of that name in the root. Like os.DirFS, it rejects names that leave it.
+type testFS struct {
+	root   string
+	search []string
+}
+
+func newTestFS(file string) *testFS {
+	fsys := &testFS{root: filepath.Dir(file)}
+	for _, dir := range filepath.SplitList(os.Getenv("MKPATH")) {
+		if dir != "" {
+			fsys.search = append(fsys.search, dir)
+		}
+	}
+
+	return fsys
+}
+
+func (t *testFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	dir, rest := t.resolve(name)
+	return os.DirFS(dir).Open(rest)
+}
+
+// searchPath returns the names of the mounted MKPATH directories, in order.
+func (t *testFS) searchPath() []string {
+	var dirs []string
+	for i := range t.search {
+		dirs = append(dirs, searchMount+"/"+strconv.Itoa(i))
+	}
+
+	return dirs
+}
+
+// hostPath returns the operating system path of the file called name.
+func (t *testFS) hostPath(name string) string {
+	dir, rest := t.resolve(name)
+	return filepath.Join(dir, filepath.FromSlash(rest))
+}
+
+// resolve returns the host directory that holds the valid name and the name
+// of the file in it.
+func (t *testFS) resolve(name string) (string, string) {
+	parts := strings.SplitN(name, "/", 3)
+	if len(parts) < 2 || parts[0] != searchMount {
+		return t.root, name
+	}
+
+	i, err := strconv.Atoi(parts[1])
+	if err != nil || i < 0 || i >= len(t.search) || strconv.Itoa(i) != parts[1] {
+		return t.root, name
+	}
+
+	if len(parts) == 2 {
+		return t.search[i], "."
+	}
+
+	return t.search[i], parts[2]
+}
+
+// findTests returns the top-level functions of program whose names start
+// with test_, in the order they are defined. A test that is defined twice is
+// reported once, at its last definition, which is the one that runs.
+func findTests(program *ast.Program) []testCase {
+	var tests []testCase
+	index := make(map[string]int)
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, testPrefix) {
+			continue
+		}
+
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+
+		test := testCase{name: let.Name.Value, position: let.Name.Token.Position}
+
+		if i, ok := index[test.name]; ok {
+			tests[i] = test
+			continue
+		}
+
+		index[test.name] = len(tests)
+		tests = append(tests, test)
+	}
+
+	return tests
+}
+
+func testArray(tests []testCase) *ast.ExpressionStatement {
+	array := &ast.ArrayLiteral{Token: token.Token{Type: token.LeftBracket, Literal: "["}}
+	for _, test := range tests {
+		array.Elements = append(array.Elements, &ast.Identifier{
+			Token: token.Token{Type: token.Identifier, Literal: test.name},
+			Value: test.name,
+		})
+	}
+
+	return &ast.ExpressionStatement{Token: array.Token, Expression: array}
+}
+
+// failure formats err with the position it was raised at, or at fallback
+// if the VM doesn't know it. Errors raised in a module are reported in the
+// file of the module, which is in fsys.
+func failure(fsys *testFS, file string, fallback token.Position, err error) string {
+	position := fallback
+	if runtimeErr, ok := err.(*vm.RuntimeError); ok {
+		if runtimeErr.File != "" {
+			file, position = fsys.hostPath(runtimeErr.File), token.Position{}
+		}
+		if runtimeErr.Position.IsValid() {
+			position = runtimeErr.Position
+		}
+	}
+
+	if !position.IsValid() {
+		return fmt.Sprintf("%s: %s", file, err)
+	}
+
+	return fmt.Sprintf("%s: %s", location(file, position), err)
+}
+
+func location(file string, position token.Position) string {
+	return fmt.Sprintf("%s:%d:%d", file, position.Line, position.Column)
+}
@@ -0,0 +1,18 @@
+import "lib/divide";
+
+let test_passes = function() {
+	assert(true);
+};
+
+let test_assert_eq = function() {
+	assert_eq(1 + 1, 3);
+};
+
+let test_runtime_error = function() {
+	let values = [1, 2];
+	values + 1;
+};
+
+let test_module_error = function() {
+	divide(1, 0);
+};
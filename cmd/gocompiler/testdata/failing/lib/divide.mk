@@ -0,0 +1,3 @@
+export let divide = function(x, y) {
+	x / y;
+};
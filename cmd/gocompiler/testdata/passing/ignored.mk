@@ -0,0 +1 @@
+let notATest = 1;
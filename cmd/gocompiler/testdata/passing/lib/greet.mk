@@ -0,0 +1,5 @@
+let greeting = "hello";
+
+export let greet = function(name) {
+	"${greeting}, ${name}";
+};
@@ -0,0 +1,16 @@
+let unless = macro(condition, consequence, alternative) {
+	quote(if (!unquote(condition)) {
+		unquote(consequence);
+	} else {
+		unquote(alternative);
+	});
+};
+
+let reverse = macro(a, b) {
+	quote(unquote(b) - unquote(a));
+};
+
+let test_macros = function() {
+	assert_eq(unless(10 > 5, "not greater", "greater"), "greater");
+	assert_eq(reverse(2 + 2, 10 - 5), 1);
+};
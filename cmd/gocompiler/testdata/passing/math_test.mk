@@ -0,0 +1,13 @@
+let double = function(x) { x * 2 };
+
+let test_double = function() {
+	assert_eq(double(2), 4);
+	assert_eq(double(-1), -2);
+};
+
+let test_errors = function() {
+	assert_error(function() { double("a") });
+	assert_error(function() { 1 / 0 }, "division by zero");
+};
+
+let helper = function() { assert(false) };
@@ -0,0 +1,5 @@
+import "lib/greet";
+
+let test_modules = function() {
+	assert_eq(greet("world"), "hello, world");
+};
@@ -0,0 +1,4 @@
+let test_interpolation = function() {
+	let name = "world";
+	assert("hello, ${name}" == "hello, world", "interpolation");
+};
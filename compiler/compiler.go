@@ -2,23 +2,63 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
 
 	"gocompiler/ast"
 	"gocompiler/ir"
 	"gocompiler/opcode"
+	"gocompiler/token"
 )
 
 type Compiler struct {
+	options Options
+
 	constants   []ir.Object
+	interned    map[constantKey]int
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIndex  int
+
+	// modules holds the modules compiled so far by name, importing the
+	// names of the modules being compiled, innermost last, and module the
+	// innermost one, or nil while compiling the main program.
+	modules   map[string]*module
+	importing []string
+	module    *module
+
+	// folded holds the result of folding each operator folded so far, or
+	// nil if it doesn't fold.
+	folded map[ast.Expression]ast.Expression
+}
+
+// Options switch optional passes of the compiler on. The zero value compiles
+// the program exactly as written.
+type Options struct {
+	// FoldConstants evaluates operators applied to literals at compile time.
+	FoldConstants bool
+	// Peephole runs Optimize over the instructions of every function and of
+	// the main program.
+	Peephole bool
+	// Loader loads the modules the program imports. Without one, imports
+	// are an error.
+	Loader Loader
+	// File is the name of the main program, as Loader names modules. It
+	// is used to report imports of the main program as cycles.
+	File string
 }
 
 type Bytecode struct {
 	Instructions opcode.Instructions
 	Constants    []ir.Object
+	// Positions maps offsets in Instructions to the source, like
+	// ir.CompiledFunction.Positions does for functions.
+	Positions map[int]token.Position
+}
+
+// constantKey identifies a constant by value, so that equal literals share
+// one slot in the constant pool.
+type constantKey struct {
+	Type  ir.ObjectType
+	Value interface{}
 }
 
 type EmittedInstruction struct {
@@ -30,9 +70,14 @@ type CompilationScope struct {
 	instructions        opcode.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	positions           map[int]token.Position
 }
 
 func New() *Compiler {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(options Options) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        opcode.Instructions{},
 		lastInstruction:     EmittedInstruction{},
@@ -40,12 +85,18 @@ func New() *Compiler {
 	}
 
 	symbolTable := NewSymbolTable()
+	for i, builtin := range ir.Builtins {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
 
 	return &Compiler{
+		options:     options,
 		constants:   []ir.Object{},
+		interned:    make(map[constantKey]int),
 		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
+		modules:     make(map[string]*module),
 	}
 }
 
@@ -53,7 +104,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
-			err := c.Compile(s)
+			var err error
+
+			// Imports and exports are only allowed at the top level.
+			switch s := s.(type) {
+			case *ast.ImportStatement:
+				err = c.compileImport(s)
+			case *ast.ExportStatement:
+				err = c.compileExport(s)
+			default:
+				err = c.Compile(s)
+			}
+
 			if err != nil {
 				return err
 			}
@@ -65,6 +127,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(opcode.OpPop)
 	case *ast.InfixExpression:
+		if c.options.FoldConstants {
+			if folded, ok := c.fold(node); ok {
+				return c.Compile(folded)
+			}
+		}
+
 		if node.Operator == "<" {
 			err := c.Compile(node.Right)
 			if err != nil {
@@ -77,6 +145,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 
 			c.emit(opcode.OpGreaterThan)
+			c.markPosition(node.Token.Position)
 
 			return nil
 		}
@@ -109,7 +178,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+
+		c.markPosition(node.Token.Position)
 	case *ast.PrefixExpression:
+		if c.options.FoldConstants {
+			if folded, ok := c.fold(node); ok {
+				return c.Compile(folded)
+			}
+		}
+
 		err := c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -123,6 +200,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+
+		c.markPosition(node.Token.Position)
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -136,14 +215,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		if c.lastInstructionIs(opcode.OpPop) {
-			c.removeLastPop()
-		}
+		c.leaveBlockValue(node.Consequence)
 
 		jumpPos := c.emit(opcode.OpJump, 9999)
 
 		afterConsequencePos := len(c.currentInstructions())
-		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+		err = c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+		if err != nil {
+			return err
+		}
 
 		if node.Alternative == nil {
 			c.emit(opcode.OpNull)
@@ -153,13 +233,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 
-			if c.lastInstructionIs(opcode.OpPop) {
-				c.removeLastPop()
-			}
+			c.leaveBlockValue(node.Alternative)
 		}
 
 		afterAlternative := len(c.currentInstructions())
-		c.changeOperand(jumpPos, afterAlternative)
+		err = c.changeOperand(jumpPos, afterAlternative)
+		if err != nil {
+			return err
+		}
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -172,6 +253,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.emit(opcode.OpIndex)
+		c.markPosition(node.Token.Position)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		// Omitted bounds are passed to the VM as null.
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(opcode.OpNull)
+				continue
+			}
+
+			err = c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(opcode.OpSlice)
+		c.markPosition(node.Token.Position)
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
 		if err != nil {
@@ -185,7 +288,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
-		c.emit(opcode.OpCall, len(node.Arguments))
+		_, err = c.emitWide(opcode.OpCall, len(node.Arguments))
+		if err != nil {
+			return err
+		}
+
+		c.markPosition(node.Token.Position)
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -194,17 +302,32 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
+		// The name is defined after its value is compiled, so that the
+		// value refers to an earlier definition of the name, as in the
+		// evaluator. Functions are the exception, so that they can call
+		// themselves.
+		var symbol Symbol
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		if isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
 
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
 
+		if !isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+
 		if symbol.Scope == GlobalScope {
-			c.emit(opcode.OpSetGlobal, symbol.Index)
+			_, err = c.emitWide(opcode.OpSetGlobal, symbol.Index)
 		} else {
-			c.emit(opcode.OpSetLocal, symbol.Index)
+			_, err = c.emitWide(opcode.OpSetLocal, symbol.Index)
+		}
+		if err != nil {
+			return err
 		}
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
@@ -219,10 +342,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("undefined variable %s", node.Value)
 		}
 
-		c.loadSymbol(symbol)
+		return c.loadSymbol(symbol)
 	case *ast.IntegerLiteral:
 		integer := &ir.Integer{Value: node.Value}
-		c.emit(opcode.OpConstant, c.addConstant(integer))
+		_, err := c.emitWide(opcode.OpConstant, c.addConstant(integer))
+		if err != nil {
+			return err
+		}
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(opcode.OpTrue)
@@ -231,7 +357,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 	case *ast.StringLiteral:
 		str := &ir.String{Value: node.Value}
-		c.emit(opcode.OpConstant, c.addConstant(str))
+		_, err := c.emitWide(opcode.OpConstant, c.addConstant(str))
+		if err != nil {
+			return err
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := c.emitWide(opcode.OpConcat, len(node.Parts))
+		if err != nil {
+			return err
+		}
 	case *ast.ArrayLiteral:
 		for _, el := range node.Elements {
 			err := c.Compile(el)
@@ -240,31 +381,29 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
-		c.emit(opcode.OpArray, len(node.Elements))
-	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-
-		for k := range node.Pairs {
-			keys = append(keys, k)
+		_, err := c.emitWide(opcode.OpArray, len(node.Elements))
+		if err != nil {
+			return err
 		}
-
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, k := range keys {
-			err := c.Compile(k)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			err := c.Compile(pair.Key)
 			if err != nil {
 				return err
 			}
 
-			err = c.Compile(node.Pairs[k])
+			err = c.Compile(pair.Value)
 			if err != nil {
 				return err
 			}
 		}
 
-		c.emit(opcode.OpHash, len(node.Pairs)*2)
+		_, err := c.emitWide(opcode.OpHash, len(node.Pairs)*2)
+		if err != nil {
+			return err
+		}
+
+		c.markPosition(node.Token.Position)
 	case *ast.FunctionLiteral:
 		c.enterScope()
 
@@ -286,34 +425,108 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		positions := c.scopes[c.scopeIndex].positions
 		instructions := c.leaveScope()
 
+		// The optimiser moves instructions, which would leave the
+		// positions pointing at the wrong ones.
+		if c.options.Peephole {
+			instructions = Optimize(instructions)
+			positions = nil
+		}
+
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			err := c.loadSymbol(s)
+			if err != nil {
+				return err
+			}
 		}
 
 		compiledfunction := &ir.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Positions:     positions,
+			File:          c.file(),
 		}
 
 		functionIndex := c.addConstant(compiledfunction)
-		c.emit(opcode.OpClosure, functionIndex, len(freeSymbols))
+		_, err = c.emitWide(opcode.OpClosure, functionIndex, len(freeSymbols))
+		if err != nil {
+			return err
+		}
+	case *ast.ImportStatement:
+		return fmt.Errorf("import %q not at top level", node.Path)
+	case *ast.ExportStatement:
+		return fmt.Errorf("export of %s not at top level", node.Statement.Name.Value)
+	case *ast.MacroLiteral:
+		// eval.DefineMacros and eval.ExpandMacros remove macros before
+		// compiling.
+		return fmt.Errorf("unexpanded macro literal")
+	case nil:
+		// The parser leaves nil behind for expressions it could not parse.
+		return fmt.Errorf("missing expression")
+	default:
+		return fmt.Errorf("unknown node %T", node)
 	}
 	return nil
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
+	instructions := c.currentInstructions()
+	positions := c.scopes[c.scopeIndex].positions
+	if c.options.Peephole {
+		instructions = Optimize(instructions)
+		positions = nil
+	}
+
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		Positions:    positions,
 	}
 }
 
 func (c *Compiler) addConstant(obj ir.Object) int {
+	key, ok := internKey(obj)
+	if ok {
+		if index, ok := c.interned[key]; ok {
+			return index
+		}
+	}
+
 	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	index := len(c.constants) - 1
+
+	if ok {
+		c.interned[key] = index
+	}
+
+	return index
+}
+
+// internKey returns the key under which obj is shared in the constant pool.
+// Compiled functions are never shared.
+func internKey(obj ir.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *ir.Integer:
+		return constantKey{Type: obj.Type(), Value: obj.Value}, true
+	case *ir.String:
+		return constantKey{Type: obj.Type(), Value: obj.Value}, true
+	default:
+		return constantKey{}, false
+	}
+}
+
+// markPosition records pos as the source of the last emitted instruction, so
+// that runtime errors in it can be traced back.
+func (c *Compiler) markPosition(pos token.Position) {
+	scope := &c.scopes[c.scopeIndex]
+	if scope.positions == nil {
+		scope.positions = make(map[int]token.Position)
+	}
+
+	scope.positions[scope.lastInstruction.Position] = pos
 }
 
 func (c *Compiler) emit(op opcode.Opcode, operands ...int) int {
@@ -325,6 +538,35 @@ func (c *Compiler) emit(op opcode.Opcode, operands ...int) int {
 	return pos
 }
 
+// emitWide emits op, switching to its wide variant when the operands do not
+// fit into the regular encoding. Operands that fit neither are an error.
+func (c *Compiler) emitWide(op opcode.Opcode, operands ...int) (int, error) {
+	def, err := opcode.Lookup(byte(op))
+	if err != nil {
+		return 0, err
+	}
+
+	if !def.Fits(operands...) {
+		wide, ok := opcode.Wide(op)
+		if !ok {
+			return 0, fmt.Errorf("operands %v out of range for %s", operands, def.Name)
+		}
+
+		wideDef, err := opcode.Lookup(byte(wide))
+		if err != nil {
+			return 0, err
+		}
+
+		if !wideDef.Fits(operands...) {
+			return 0, fmt.Errorf("operands %v out of range for %s", operands, wideDef.Name)
+		}
+
+		op = wide
+	}
+
+	return c.emit(op, operands...), nil
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
@@ -373,6 +615,21 @@ func (c *Compiler) removePreviousPop() {
 	c.scopes[c.scopeIndex].previousInstruction = last
 }
 
+// leaveBlockValue makes the block just compiled leave its value on the
+// stack: the value of its last statement if that is an expression
+// statement, and null otherwise.
+func (c *Compiler) leaveBlockValue(block *ast.BlockStatement) {
+	if n := len(block.Statements); n > 0 {
+		_, ok := block.Statements[n-1].(*ast.ExpressionStatement)
+		if ok && c.lastInstructionIs(opcode.OpPop) {
+			c.removeLastPop()
+			return
+		}
+	}
+
+	c.emit(opcode.OpNull)
+}
+
 func (c *Compiler) removeLastPop() {
 	last := c.scopes[c.scopeIndex].lastInstruction
 	previous := c.scopes[c.scopeIndex].previousInstruction
@@ -392,11 +649,23 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 	}
 }
 
-func (c *Compiler) changeOperand(opPos int, operand int) {
+func (c *Compiler) changeOperand(opPos int, operand int) error {
 	op := opcode.Opcode(c.currentInstructions()[opPos])
+
+	def, err := opcode.Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+
+	if !def.Fits(operand) {
+		return fmt.Errorf("operand %d out of range for %s", operand, def.Name)
+	}
+
 	newInstruction := opcode.Make(op, operand)
 
 	c.replaceInstruction(opPos, newInstruction)
+
+	return nil
 }
 
 func (c *Compiler) currentInstructions() opcode.Instructions {
@@ -431,13 +700,19 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = opcode.OpReturnValue
 }
 
-func (c *Compiler) loadSymbol(s Symbol) {
+func (c *Compiler) loadSymbol(s Symbol) error {
+	var err error
+
 	switch s.Scope {
 	case GlobalScope:
-		c.emit(opcode.OpGetGlobal, s.Index)
+		_, err = c.emitWide(opcode.OpGetGlobal, s.Index)
 	case LocalScope:
-		c.emit(opcode.OpGetLocal, s.Index)
+		_, err = c.emitWide(opcode.OpGetLocal, s.Index)
 	case FreeScope:
-		c.emit(opcode.OpGetFree, s.Index)
+		_, err = c.emitWide(opcode.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(opcode.OpGetBuiltin, s.Index)
 	}
+
+	return err
 }
@@ -2,6 +2,8 @@ package compiler
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"gocompiler/ast"
@@ -9,6 +11,7 @@ import (
 	"gocompiler/lexer"
 	"gocompiler/opcode"
 	"gocompiler/parser"
+	"gocompiler/token"
 )
 
 type compilerTestCase struct {
@@ -78,7 +81,7 @@ func TestIntegerArithmetic(t *testing.T) {
 			},
 		}, {
 			input:             "1 < 2",
-			expectedConstants: []interface{}{1, 2},
+			expectedConstants: []interface{}{2, 1},
 			expectedInstructions: []opcode.Instructions{
 				opcode.Make(opcode.OpConstant, 0),
 				opcode.Make(opcode.OpConstant, 1),
@@ -299,6 +302,27 @@ func TestStringExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"a${1}b${2 + 3}"`,
+			expectedConstants: []interface{}{"a", 1, "b", 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpConstant, 3),
+				opcode.Make(opcode.OpConstant, 4),
+				opcode.Make(opcode.OpAdd),
+				opcode.Make(opcode.OpConcat, 4),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestArrayLiterals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -366,6 +390,18 @@ func TestHashLiterals(t *testing.T) {
 				opcode.Make(opcode.OpPop),
 			},
 		},
+		{
+			input:             "{5: 6, 1: 2}",
+			expectedConstants: []interface{}{5, 6, 1, 2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpConstant, 3),
+				opcode.Make(opcode.OpHash, 4),
+				opcode.Make(opcode.OpPop),
+			},
+		},
 		{
 			input:             "{1: 2 + 3, 4: 5 * 6}",
 			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
@@ -391,14 +427,14 @@ func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []opcode.Instructions{
 				opcode.Make(opcode.OpConstant, 0),
 				opcode.Make(opcode.OpConstant, 1),
 				opcode.Make(opcode.OpConstant, 2),
 				opcode.Make(opcode.OpArray, 3),
-				opcode.Make(opcode.OpConstant, 3),
-				opcode.Make(opcode.OpConstant, 4),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 0),
 				opcode.Make(opcode.OpAdd),
 				opcode.Make(opcode.OpIndex),
 				opcode.Make(opcode.OpPop),
@@ -406,18 +442,35 @@ func TestIndexExpressions(t *testing.T) {
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []opcode.Instructions{
 				opcode.Make(opcode.OpConstant, 0),
 				opcode.Make(opcode.OpConstant, 1),
 				opcode.Make(opcode.OpHash, 2),
-				opcode.Make(opcode.OpConstant, 2),
-				opcode.Make(opcode.OpConstant, 3),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 0),
 				opcode.Make(opcode.OpSub),
 				opcode.Make(opcode.OpIndex),
 				opcode.Make(opcode.OpPop),
 			},
 		},
+		{
+			input:             `"abc"[1:]; [1][:1]`,
+			expectedConstants: []interface{}{"abc", 1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpSlice),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpArray, 1),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpSlice),
+				opcode.Make(opcode.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -697,9 +750,15 @@ func TestFunctionCalls(t *testing.T) {
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
+	runCompilerTestsWithOptions(t, Options{}, tests)
+}
+
+func runCompilerTestsWithOptions(t *testing.T, options Options, tests []compilerTestCase) {
+	t.Helper()
+
 	for _, tt := range tests {
 		program := parse(tt.input)
-		compiler := New()
+		compiler := NewWithOptions(options)
 
 		err := compiler.Compile(program)
 		if err != nil {
@@ -720,6 +779,91 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	}
 }
 
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `assert(true); assert_eq(1, 1);`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpGetBuiltin, 0),
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpCall, 1),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpGetBuiltin, 1),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpCall, 2),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: `function() { assert_error }`,
+			expectedConstants: []interface{}{
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpGetBuiltin, 2),
+					opcode.Make(opcode.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `let assert = 1; assert`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestPositions(t *testing.T) {
+	input := "let f = function(a) {\n  a / 0\n};\nf(1)[2]"
+
+	compiler := New()
+
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	expected := map[int]token.Position{
+		13: {Line: 4, Column: 2}, // OpCall
+		18: {Line: 4, Column: 5}, // OpIndex
+	}
+	if !reflect.DeepEqual(bytecode.Positions, expected) {
+		t.Errorf("wrong positions. want=%v, got=%v", expected, bytecode.Positions)
+	}
+
+	fn := bytecode.Constants[1].(*ir.CompiledFunction)
+	expected = map[int]token.Position{
+		5: {Line: 2, Column: 5}, // OpDiv
+	}
+	if !reflect.DeepEqual(fn.Positions, expected) {
+		t.Errorf("wrong function positions. want=%v, got=%v", expected, fn.Positions)
+	}
+
+	compiler = NewWithOptions(Options{Peephole: true})
+
+	err = compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if positions := compiler.Bytecode().Positions; positions != nil {
+		t.Errorf("optimised bytecode has positions: %v", positions)
+	}
+}
+
 func TestLetStatementScopes(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -921,6 +1065,299 @@ func TestClosure(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestConstantInterning(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `1; "key"; 1; "key"; function() { 1 }; function() { 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				"key",
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpConstant, 0),
+					opcode.Make(opcode.OpReturnValue),
+				},
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpConstant, 0),
+					opcode.Make(opcode.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpClosure, 2, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpClosure, 3, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `"1"; 1`,
+			expectedConstants: []interface{}{"1", 1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstantFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2 * 3",
+			expectedConstants: []interface{}{7},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "-(1 - 3)",
+			expectedConstants: []interface{}{2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "!true; !!5; 1 < 2; true != false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpFalse),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `"a" < "b"; "b" > "ab"; "a" == "b"; "a" != "b"`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpFalse),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x + 2 * 3",
+			expectedConstants: []interface{}{1, 6},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpAdd),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "1 / (2 - 2)",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpDiv),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `-true; 1 + "a"`,
+			expectedConstants: []interface{}{1, "a"},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpMinus),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpAdd),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, Options{FoldConstants: true}, tests)
+}
+
+// TestFoldOperatorsOnce checks that the operands of an operator that
+// doesn't fold are not folded all over again when they are compiled.
+func TestFoldOperatorsOnce(t *testing.T) {
+	input := "x"
+	for i := 0; i < 1000; i++ {
+		input = "(" + input + " + (1 + 2))"
+	}
+
+	compiler := NewWithOptions(Options{FoldConstants: true})
+
+	err := compiler.Compile(parse("let x = 1; " + input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// Every level has two operators, of which the inner one folds.
+	if len(compiler.folded) != 2000 {
+		t.Errorf("wrong number of folded operators. want=2000, got=%d", len(compiler.folded))
+	}
+
+	unfolded := 0
+	for _, folded := range compiler.folded {
+		if folded == nil {
+			unfolded++
+		}
+	}
+
+	if unfolded != 1000 {
+		t.Errorf("wrong number of operators that don't fold. want=1000, got=%d", unfolded)
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	params := make([]string, 257)
+	for i := range params {
+		params[i] = identifier(i)
+	}
+
+	tests := []compilerTestCase{
+		{
+			input: fmt.Sprintf("function(%s) { %s }", strings.Join(params, ", "), identifier(256)),
+			expectedConstants: []interface{}{
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpGetLocalWide, 256),
+					opcode.Make(opcode.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestOperandOutOfRange(t *testing.T) {
+	elements := make([]string, 65536)
+	for i := range elements {
+		elements[i] = "true"
+	}
+
+	input := "[" + strings.Join(elements, ", ") + "]"
+	expected := "operands [65536] out of range for OpArray"
+
+	compiler := New()
+
+	err := compiler.Compile(parse(input))
+	if err == nil {
+		t.Fatalf("expected compiler error but resulted in none.")
+	}
+
+	if err.Error() != expected {
+		t.Fatalf("wrong compiler error: want=%q, got=%q", expected, err.Error())
+	}
+}
+
+func TestIncompletePrograms(t *testing.T) {
+	tests := []string{
+		"let x = ;",
+		"1 + ;",
+		"if (true) { -; }",
+		"[1, 2][;",
+		"function(a) { return; }",
+	}
+
+	for _, input := range tests {
+		compiler := New()
+
+		err := compiler.Compile(parse(input))
+		if err == nil {
+			t.Errorf("%q: expected compiler error but resulted in none.", input)
+			continue
+		}
+
+		if err.Error() != "missing expression" {
+			t.Errorf("%q: wrong compiler error: got=%q", input, err.Error())
+		}
+	}
+}
+
+// TestLetValueBeforeName checks that the value of a let statement can't read
+// the name it defines, which would read a slot that was never set.
+func TestLetValueBeforeName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"function() { let f = f() }()", "undefined variable f"},
+		{"function() { let x = x + 1; x }()", "undefined variable x"},
+		{"function() { let x = -x; x }()", "undefined variable x"},
+		{"function() { let x = [x]; x }()", "undefined variable x"},
+		{`function() { let x = "${x}"; x }()`, "undefined variable x"},
+		{"let b = b;", "undefined variable b"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("%q: expected compiler error but resulted in none.", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong compiler error: want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestUnexpandedMacros(t *testing.T) {
+	tests := []string{
+		"let m = macro(a) { a };",
+		"function() { macro() { 1 } };",
+	}
+
+	for _, input := range tests {
+		compiler := New()
+
+		err := compiler.Compile(parse(input))
+		if err == nil {
+			t.Errorf("%q: expected compiler error but resulted in none.", input)
+			continue
+		}
+
+		if err.Error() != "unexpanded macro literal" {
+			t.Errorf("%q: wrong compiler error: got=%q", input, err.Error())
+		}
+	}
+}
+
 func testInstructions(expected []opcode.Instructions, actual opcode.Instructions) error {
 	concatted := concatInstructions(expected)
 
@@ -982,7 +1419,11 @@ func testConstants(t *testing.T, expected []interface{}, actual []ir.Object) err
 func testIntegerObject(expected int64, actual ir.Object) error {
 	result, ok := actual.(*ir.Integer)
 	if !ok {
-		return fmt.Errorf("ir is not Integer. got=%T (%+v)", result.Value, expected)
+		return fmt.Errorf("ir is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("ir has wrong value. got=%d, want=%d", result.Value, expected)
 	}
 
 	return nil
@@ -1001,8 +1442,48 @@ func testStringObject(expected string, actual ir.Object) error {
 	return nil
 }
 
+// identifier returns a unique identifier for i. Identifiers can't contain
+// digits, so they are spelled with letters.
+func identifier(i int) string {
+	return "p" + strings.Map(func(r rune) rune { return r - '0' + 'a' }, fmt.Sprint(i))
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
 	return p.ParseProgram()
 }
+
+func FuzzCompile(f *testing.F) {
+	seeds := []string{
+		"1 + 2; 1 - 2; 1 * 2; 2 / 1; -1; !true",
+		"if (true) { 10 } else { 20 }; 3333;",
+		"let one = 1; let two = one; two;",
+		`"mon" + "key"; "a${1}b${"c"}"`,
+		`[1, 2, 3][1 + 1]; {1: 2}[2 - 1]; "abc"[1:]`,
+		"function() { return 5 + 10 }",
+		"let num = 55; function() { let a = 1; num + a }",
+		"function(a) { function(b) { function(c) { a + b + c } } }",
+		"let countDown = function(x) { countDown(x - 1); }; countDown(1);",
+		"let x = ; if (",
+		"let",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		// Programs with parse errors are compiled as well, to make sure the
+		// compiler copes with the incomplete trees the parser leaves behind.
+		program := parse(input)
+
+		for _, options := range []Options{{}, {FoldConstants: true, Peephole: true}} {
+			comp := NewWithOptions(options)
+			if comp.Compile(program) != nil {
+				continue
+			}
+
+			_ = comp.Bytecode().Instructions.String()
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package compiler
+
+import (
+	"strconv"
+
+	"gocompiler/ast"
+	"gocompiler/token"
+)
+
+// fold evaluates expr at compile time when it is built from literals only.
+// It reports false for anything that has to be left to the VM, including
+// operations that would fail at runtime, such as division by zero.
+//
+// Compiling an operator that doesn't fold goes on to fold its operands, so
+// the result for every operator is kept: each one is folded only once.
+func (c *Compiler) fold(expr ast.Expression) (ast.Expression, bool) {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return expr, true
+	case *ast.PrefixExpression, *ast.InfixExpression:
+	default:
+		return nil, false
+	}
+
+	if folded, ok := c.folded[expr]; ok {
+		return folded, folded != nil
+	}
+
+	folded, ok := c.foldOperator(expr)
+	if !ok {
+		folded = nil
+	}
+
+	if c.folded == nil {
+		c.folded = make(map[ast.Expression]ast.Expression)
+	}
+	c.folded[expr] = folded
+
+	return folded, ok
+}
+
+func (c *Compiler) foldOperator(expr ast.Expression) (ast.Expression, bool) {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		right, ok := c.fold(expr.Right)
+		if !ok {
+			return nil, false
+		}
+
+		return foldPrefix(expr.Operator, right)
+	case *ast.InfixExpression:
+		left, ok := c.fold(expr.Left)
+		if !ok {
+			return nil, false
+		}
+
+		right, ok := c.fold(expr.Right)
+		if !ok {
+			return nil, false
+		}
+
+		return foldInfix(expr.Operator, left, right)
+	default:
+		return nil, false
+	}
+}
+
+func foldPrefix(operator string, right ast.Expression) (ast.Expression, bool) {
+	switch operator {
+	case "!":
+		if b, ok := right.(*ast.Boolean); ok {
+			return newBoolean(!b.Value), true
+		}
+
+		// Integers and strings are always truthy.
+		return newBoolean(false), true
+	case "-":
+		if i, ok := right.(*ast.IntegerLiteral); ok {
+			return newInteger(-i.Value), true
+		}
+	}
+
+	return nil, false
+}
+
+func foldInfix(operator string, left, right ast.Expression) (ast.Expression, bool) {
+	switch left := left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := right.(*ast.IntegerLiteral)
+		if !ok {
+			return nil, false
+		}
+
+		return foldIntegerInfix(operator, left.Value, right.Value)
+	case *ast.StringLiteral:
+		right, ok := right.(*ast.StringLiteral)
+		if !ok {
+			return nil, false
+		}
+
+		return foldStringInfix(operator, left.Value, right.Value)
+	case *ast.Boolean:
+		right, ok := right.(*ast.Boolean)
+		if !ok {
+			return nil, false
+		}
+
+		switch operator {
+		case "==":
+			return newBoolean(left.Value == right.Value), true
+		case "!=":
+			return newBoolean(left.Value != right.Value), true
+		}
+	}
+
+	return nil, false
+}
+
+func foldIntegerInfix(operator string, left, right int64) (ast.Expression, bool) {
+	switch operator {
+	case "+":
+		return newInteger(left + right), true
+	case "-":
+		return newInteger(left - right), true
+	case "*":
+		return newInteger(left * right), true
+	case "/":
+		if right == 0 {
+			return nil, false
+		}
+		return newInteger(left / right), true
+	case "<":
+		return newBoolean(left < right), true
+	case ">":
+		return newBoolean(left > right), true
+	case "==":
+		return newBoolean(left == right), true
+	case "!=":
+		return newBoolean(left != right), true
+	default:
+		return nil, false
+	}
+}
+
+func foldStringInfix(operator string, left, right string) (ast.Expression, bool) {
+	switch operator {
+	case "+":
+		return newString(left + right), true
+	case "<":
+		return newBoolean(left < right), true
+	case ">":
+		return newBoolean(left > right), true
+	case "==":
+		return newBoolean(left == right), true
+	case "!=":
+		return newBoolean(left != right), true
+	default:
+		return nil, false
+	}
+}
+
+func newInteger(value int64) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.Int, Literal: literal}, Value: value}
+}
+
+func newString(value string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: token.Token{Type: token.String, Literal: value}, Value: value}
+}
+
+func newBoolean(value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: token.Token{Type: token.True, Literal: "true"}, Value: true}
+	}
+
+	return &ast.Boolean{Token: token.Token{Type: token.False, Literal: "false"}, Value: false}
+}
@@ -0,0 +1,192 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gocompiler/ast"
+	"gocompiler/ir"
+	"gocompiler/opcode"
+)
+
+// Loader finds and parses the modules a program imports.
+type Loader interface {
+	// Load returns the module that path refers to when it is imported by
+	// the module called from, or by the main program if from is empty.
+	// The name identifies the module: paths that refer to the same module
+	// must give the same name.
+	Load(path, from string) (name string, program *ast.Program, err error)
+}
+
+// module is a compiled module. Its code is compiled into a function without
+// parameters that runs the module when it is first imported.
+type module struct {
+	name    string
+	symbols *SymbolTable
+	exports map[string]Symbol
+}
+
+// compileImport runs the module imported by node, unless an earlier import
+// already did, and defines the names it exports. Modules have their own
+// namespace: only the exported names are visible to the importer, and
+// nothing of the importer is visible to the module. An exported name may
+// not replace one the importer has already defined or imported from another
+// module, though it may shadow a builtin.
+func (c *Compiler) compileImport(node *ast.ImportStatement) error {
+	if c.options.Loader == nil {
+		return fmt.Errorf("import %q: no module loader", node.Path)
+	}
+
+	name, program, err := c.options.Loader.Load(node.Path, c.file())
+	if err != nil {
+		return fmt.Errorf("import %q: %s", node.Path, err)
+	}
+
+	if cycle := c.importCycle(name); cycle != nil {
+		return fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	m, ok := c.modules[name]
+	if !ok {
+		m, err = c.compileModule(name, program)
+		if err != nil {
+			return err
+		}
+
+		c.modules[name] = m
+	}
+
+	names := make([]string, 0, len(m.exports))
+	for exported := range m.exports {
+		names = append(names, exported)
+	}
+	sort.Strings(names)
+
+	for _, exported := range names {
+		symbol := m.exports[exported]
+
+		existing, ok := c.symbolTable.store[exported]
+		if ok && existing.Scope != BuiltinScope &&
+			(existing.Scope != symbol.Scope || existing.Index != symbol.Index) {
+			return fmt.Errorf("import %q: %s already defined", node.Path, exported)
+		}
+
+		c.symbolTable.DefineImport(exported, symbol)
+	}
+
+	return nil
+}
+
+// compileModule compiles program as the module called name and emits the
+// code that runs it.
+func (c *Compiler) compileModule(name string, program *ast.Program) (*module, error) {
+	m := &module{
+		name:    name,
+		symbols: NewModuleSymbolTable(c.symbolTable),
+		exports: make(map[string]Symbol),
+	}
+
+	outer, importer := c.symbolTable, c.module
+
+	c.enterScope()
+	c.symbolTable = m.symbols
+	c.importing = append(c.importing, name)
+	c.module = m
+
+	err := c.Compile(program)
+
+	c.module = importer
+	c.importing = c.importing[:len(c.importing)-1]
+
+	if err != nil {
+		c.leaveScope()
+		c.symbolTable = outer
+
+		if _, ok := err.(*moduleError); !ok {
+			err = &moduleError{file: name, err: err}
+		}
+		return nil, err
+	}
+
+	c.emit(opcode.OpReturn)
+
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+	c.symbolTable = outer
+
+	if c.options.Peephole {
+		instructions = Optimize(instructions)
+		positions = nil
+	}
+
+	init := &ir.CompiledFunction{
+		Instructions: instructions,
+		Positions:    positions,
+		File:         name,
+	}
+
+	_, err = c.emitWide(opcode.OpClosure, c.addConstant(init), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.emitWide(opcode.OpCall, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	c.emit(opcode.OpPop)
+
+	return m, nil
+}
+
+// moduleError is an error in the code of a module, as opposed to one in the
+// import statement of the importer.
+type moduleError struct {
+	file string
+	err  error
+}
+
+func (e *moduleError) Error() string { return e.file + ": " + e.err.Error() }
+
+// compileExport compiles the let statement of node and, in a module, exports
+// the name it defines. Exports of the main program are plain definitions.
+func (c *Compiler) compileExport(node *ast.ExportStatement) error {
+	err := c.Compile(node.Statement)
+	if err != nil {
+		return err
+	}
+
+	if c.module != nil {
+		name := node.Statement.Name.Value
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.module.exports[name] = symbol
+	}
+
+	return nil
+}
+
+// importCycle returns the chain of imports that leads from name back to
+// itself, or nil if importing name doesn't close a cycle.
+func (c *Compiler) importCycle(name string) []string {
+	chain := append([]string{c.options.File}, c.importing...)
+
+	for i, importer := range chain {
+		if importer != "" && importer == name {
+			return append(chain[i:len(chain):len(chain)], name)
+		}
+	}
+
+	return nil
+}
+
+// file returns the name of the module being compiled, or the empty string
+// for the main program.
+func (c *Compiler) file() string {
+	if c.module == nil {
+		return ""
+	}
+
+	return c.module.name
+}
@@ -0,0 +1,189 @@
+package compiler
+
+import (
+	"fmt"
+	"testing"
+
+	"gocompiler/ast"
+	"gocompiler/ir"
+	"gocompiler/opcode"
+)
+
+// mapLoader loads modules from a map from names to source. Paths are names.
+type mapLoader map[string]string
+
+func (l mapLoader) Load(path, from string) (string, *ast.Program, error) {
+	input, ok := l[path]
+	if !ok {
+		return "", nil, fmt.Errorf("no module %s", path)
+	}
+
+	return path, parse(input), nil
+}
+
+func TestImports(t *testing.T) {
+	loader := mapLoader{
+		"one": "export let one = 1; let hidden = 2;",
+		"two": `import "one"; export let two = one + one;`,
+	}
+
+	tests := []compilerTestCase{
+		{
+			input: `import "one"; one;`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpConstant, 0),
+					opcode.Make(opcode.OpSetGlobal, 0),
+					opcode.Make(opcode.OpConstant, 1),
+					opcode.Make(opcode.OpSetGlobal, 1),
+					opcode.Make(opcode.OpReturn),
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 2, 0),
+				opcode.Make(opcode.OpCall, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			// The main program and the module have separate
+			// namespaces, but share the globals.
+			input: `let hidden = 5; import "one"; hidden; let hidden = 6;`,
+			expectedConstants: []interface{}{
+				5,
+				1,
+				2,
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpConstant, 1),
+					opcode.Make(opcode.OpSetGlobal, 1),
+					opcode.Make(opcode.OpConstant, 2),
+					opcode.Make(opcode.OpSetGlobal, 2),
+					opcode.Make(opcode.OpReturn),
+				},
+				6,
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpClosure, 3, 0),
+				opcode.Make(opcode.OpCall, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 4),
+				opcode.Make(opcode.OpSetGlobal, 3),
+			},
+		},
+		{
+			// A module runs once, however often it is imported.
+			input: `import "two"; import "one"; one + two;`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpConstant, 0),
+					opcode.Make(opcode.OpSetGlobal, 0),
+					opcode.Make(opcode.OpConstant, 1),
+					opcode.Make(opcode.OpSetGlobal, 1),
+					opcode.Make(opcode.OpReturn),
+				},
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpClosure, 2, 0),
+					opcode.Make(opcode.OpCall, 0),
+					opcode.Make(opcode.OpPop),
+					opcode.Make(opcode.OpGetGlobal, 0),
+					opcode.Make(opcode.OpGetGlobal, 0),
+					opcode.Make(opcode.OpAdd),
+					opcode.Make(opcode.OpSetGlobal, 2),
+					opcode.Make(opcode.OpReturn),
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 3, 0),
+				opcode.Make(opcode.OpCall, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 2),
+				opcode.Make(opcode.OpAdd),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, Options{Loader: loader}, tests)
+}
+
+func TestModuleFiles(t *testing.T) {
+	loader := mapLoader{"lib": "export let f = function() { 1 };"}
+
+	compiler := NewWithOptions(Options{Loader: loader})
+
+	err := compiler.Compile(parse(`import "lib"; let g = function() { f() };`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	files := map[string]bool{}
+	for _, constant := range compiler.Bytecode().Constants {
+		if fn, ok := constant.(*ir.CompiledFunction); ok {
+			files[fn.File] = true
+		}
+	}
+
+	if len(files) != 2 || !files["lib"] || !files[""] {
+		t.Errorf("wrong files of the functions: %v", files)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	loader := mapLoader{
+		"a":        `import "b";`,
+		"b":        `import "a";`,
+		"self":     `import "self";`,
+		"main":     "export let x = 1;",
+		"usesmain": `import "main";`,
+		"broken":   "export let x = y;",
+		"nested":   `import "broken";`,
+		"private":  "let x = 1;",
+		"first":    "export let x = 1;",
+		"other":    "export let x = 2;",
+	}
+
+	tests := []struct {
+		input    string
+		loader   Loader
+		expected string
+	}{
+		{`import "a";`, nil, `import "a": no module loader`},
+		{`import "missing";`, loader, `import "missing": no module missing`},
+		{`import "a";`, loader, "b: import cycle: a -> b -> a"},
+		{`import "self";`, loader, "self: import cycle: self -> self"},
+		{`import "usesmain";`, loader, "usesmain: import cycle: main -> usesmain -> main"},
+		{`import "broken";`, loader, "broken: undefined variable y"},
+		{`import "nested";`, loader, "broken: undefined variable y"},
+		{`import "private"; x`, loader, "undefined variable x"},
+		{`import "main";`, loader, "import cycle: main -> main"},
+		{`let x = 1; import "other"; x`, loader, `import "other": x already defined`},
+		{`import "first"; import "other";`, loader, `import "other": x already defined`},
+		{`function() { import "main"; }`, loader, `import "main" not at top level`},
+		{`if (true) { export let x = 1; }`, loader, "export of x not at top level"},
+	}
+
+	for _, tt := range tests {
+		compiler := NewWithOptions(Options{Loader: tt.loader, File: "main"})
+
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("%q: expected compiler error but resulted in none.", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong compiler error.\nwant=%q\ngot =%q", tt.input, tt.expected, err)
+		}
+	}
+}
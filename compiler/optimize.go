@@ -0,0 +1,299 @@
+package compiler
+
+import (
+	"gocompiler/opcode"
+)
+
+// instruction is a decoded instruction of the peephole optimiser. Jump
+// targets are kept as indices into the instruction list, so instructions can
+// be removed without breaking them.
+type instruction struct {
+	op       opcode.Opcode
+	operands []int
+	target   int
+	removed  bool
+}
+
+type optimizer struct {
+	ins []*instruction
+	// targeted counts the jumps that target each index; the extra last slot
+	// stands for the end of the instructions.
+	targeted []int
+}
+
+// Optimize runs a peephole pass over ins: it threads jumps that target
+// jumps, turns conditional jumps over constants into unconditional ones,
+// drops values that are pushed and popped right away, and removes code that
+// can't be reached after a jump or return. The final OpPop of a program is
+// kept, because it holds the program's result. Instructions that can't be
+// decoded are returned unchanged.
+func Optimize(ins opcode.Instructions) opcode.Instructions {
+	o, ok := newOptimizer(ins)
+	if !ok {
+		return ins
+	}
+
+	for o.threadJumps() || o.foldConditions() || o.dropPushPop() || o.removeDeadCode() {
+	}
+
+	return o.encode()
+}
+
+func newOptimizer(ins opcode.Instructions) (*optimizer, bool) {
+	o := &optimizer{}
+	index := make(map[int]int)
+
+	for offset := 0; offset < len(ins); {
+		def, err := opcode.Lookup(ins[offset])
+		if err != nil {
+			return nil, false
+		}
+
+		if offset+1+def.Width() > len(ins) {
+			return nil, false
+		}
+
+		operands, read := opcode.ReadOperands(def, ins[offset+1:])
+
+		index[offset] = len(o.ins)
+		o.ins = append(o.ins, &instruction{op: opcode.Opcode(ins[offset]), operands: operands})
+
+		offset += read + 1
+	}
+	index[len(ins)] = len(o.ins)
+
+	o.targeted = make([]int, len(o.ins)+1)
+
+	for _, in := range o.ins {
+		if !isJump(in.op) {
+			continue
+		}
+
+		target, ok := index[in.operands[0]]
+		if !ok {
+			return nil, false
+		}
+
+		in.target = target
+		o.targeted[target]++
+	}
+
+	return o, true
+}
+
+func isJump(op opcode.Opcode) bool {
+	return op == opcode.OpJump || op == opcode.OpJumpNotTruthy
+}
+
+// threadJumps retargets jumps that land on unconditional jumps to the final
+// destination, and removes jumps to the instruction that follows anyway.
+func (o *optimizer) threadJumps() bool {
+	changed := false
+
+	for i, in := range o.ins {
+		if in.removed || !isJump(in.op) {
+			continue
+		}
+
+		target, ok := o.finalTarget(in)
+		if !ok {
+			continue
+		}
+
+		if target != in.target {
+			o.setTarget(in, target)
+			changed = true
+		}
+
+		if target == o.nextLive(i+1) {
+			// Jumping to the next instruction only leaves the condition of
+			// a conditional jump to be popped.
+			if in.op == opcode.OpJump {
+				o.remove(i)
+			} else {
+				o.targeted[in.target]--
+				in.op = opcode.OpPop
+				in.operands = nil
+			}
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// finalTarget follows the chain of unconditional jumps starting at the target
+// of in. It reports false if the chain loops.
+func (o *optimizer) finalTarget(in *instruction) (int, bool) {
+	visited := make(map[int]bool)
+	target := o.nextLive(in.target)
+
+	for target < len(o.ins) && o.ins[target].op == opcode.OpJump {
+		if visited[target] {
+			return 0, false
+		}
+		visited[target] = true
+
+		target = o.nextLive(o.ins[target].target)
+	}
+
+	return target, true
+}
+
+// foldConditions rewrites conditional jumps whose condition is pushed by the
+// instruction right before them.
+func (o *optimizer) foldConditions() bool {
+	changed := false
+
+	for i, in := range o.ins {
+		if in.removed || in.op != opcode.OpJumpNotTruthy || o.isLeader(i) {
+			continue
+		}
+
+		p := o.prevLive(i)
+		if p < 0 {
+			continue
+		}
+
+		switch o.ins[p].op {
+		case opcode.OpTrue, opcode.OpConstant, opcode.OpConstantWide:
+			o.remove(p)
+			o.remove(i)
+			changed = true
+		case opcode.OpFalse, opcode.OpNull:
+			o.remove(p)
+			in.op = opcode.OpJump
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// dropPushPop removes values that are popped right after being pushed, if
+// pushing them has no side effects.
+func (o *optimizer) dropPushPop() bool {
+	changed := false
+	last := o.prevLive(len(o.ins))
+
+	for i, in := range o.ins {
+		if in.removed || in.op != opcode.OpPop || i == last || o.isLeader(i) {
+			continue
+		}
+
+		p := o.prevLive(i)
+		if p < 0 {
+			continue
+		}
+
+		switch o.ins[p].op {
+		case opcode.OpConstant, opcode.OpConstantWide,
+			opcode.OpTrue, opcode.OpFalse, opcode.OpNull,
+			opcode.OpGetGlobal, opcode.OpGetGlobalWide,
+			opcode.OpGetLocal, opcode.OpGetLocalWide,
+			opcode.OpGetFree, opcode.OpGetFreeWide:
+			o.remove(p)
+			o.remove(i)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// removeDeadCode removes instructions following a jump or a return up to the
+// next jump target.
+func (o *optimizer) removeDeadCode() bool {
+	changed := false
+
+	for i, in := range o.ins {
+		if in.removed {
+			continue
+		}
+
+		switch in.op {
+		case opcode.OpJump, opcode.OpReturnValue, opcode.OpReturn:
+		default:
+			continue
+		}
+
+		for j := i + 1; j < len(o.ins) && !o.isLeader(j); j++ {
+			if !o.ins[j].removed {
+				o.remove(j)
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+func (o *optimizer) encode() opcode.Instructions {
+	offsets := make([]int, len(o.ins)+1)
+	offset := 0
+
+	for i, in := range o.ins {
+		offsets[i] = offset
+		if !in.removed {
+			offset += len(opcode.Make(in.op, in.operands...))
+		}
+	}
+	offsets[len(o.ins)] = offset
+
+	out := opcode.Instructions{}
+
+	for _, in := range o.ins {
+		if in.removed {
+			continue
+		}
+
+		operands := in.operands
+		if isJump(in.op) {
+			operands = []int{offsets[o.nextLive(in.target)]}
+		}
+
+		out = append(out, opcode.Make(in.op, operands...)...)
+	}
+
+	return out
+}
+
+// isLeader reports whether the live instruction at i starts a basic block,
+// that is whether some jump lands on it.
+func (o *optimizer) isLeader(i int) bool {
+	for t := o.prevLive(i) + 1; t <= i; t++ {
+		if o.targeted[t] > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *optimizer) remove(i int) {
+	in := o.ins[i]
+	if isJump(in.op) {
+		o.targeted[in.target]--
+	}
+	in.removed = true
+}
+
+func (o *optimizer) setTarget(in *instruction, target int) {
+	o.targeted[in.target]--
+	in.target = target
+	o.targeted[target]++
+}
+
+func (o *optimizer) prevLive(i int) int {
+	for i--; i >= 0 && o.ins[i].removed; i-- {
+	}
+
+	return i
+}
+
+func (o *optimizer) nextLive(i int) int {
+	for ; i < len(o.ins) && o.ins[i].removed; i++ {
+	}
+
+	return i
+}
@@ -0,0 +1,204 @@
+package compiler
+
+import (
+	"testing"
+
+	"gocompiler/opcode"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    []opcode.Instructions
+		expected []opcode.Instructions
+	}{
+		{
+			input: []opcode.Instructions{
+				opcode.Make(opcode.OpReturnValue),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpReturnValue),
+			},
+			expected: []opcode.Instructions{
+				opcode.Make(opcode.OpReturnValue),
+			},
+		},
+		{
+			input: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpConstant, 0),
+				// 0003
+				opcode.Make(opcode.OpPop),
+				// 0004
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0006
+				opcode.Make(opcode.OpPop),
+				// 0007
+				opcode.Make(opcode.OpConstant, 1),
+				// 0010
+				opcode.Make(opcode.OpPop),
+			},
+			expected: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpFalse),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 10),
+				// 0004
+				opcode.Make(opcode.OpConstant, 0),
+				// 0007
+				opcode.Make(opcode.OpJump, 13),
+				// 0010
+				opcode.Make(opcode.OpConstant, 1),
+				// 0013
+				opcode.Make(opcode.OpPop),
+			},
+			expected: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpTrue),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 10),
+				// 0004
+				opcode.Make(opcode.OpConstant, 0),
+				// 0007
+				opcode.Make(opcode.OpJump, 13),
+				// 0010
+				opcode.Make(opcode.OpConstant, 1),
+				// 0013
+				opcode.Make(opcode.OpPop),
+			},
+			expected: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0003
+				opcode.Make(opcode.OpJumpNotTruthy, 12),
+				// 0006
+				opcode.Make(opcode.OpGetGlobal, 1),
+				// 0009
+				opcode.Make(opcode.OpJump, 18),
+				// 0012
+				opcode.Make(opcode.OpJump, 21),
+				// 0015
+				opcode.Make(opcode.OpGetGlobal, 2),
+				// 0018
+				opcode.Make(opcode.OpJump, 21),
+				// 0021
+				opcode.Make(opcode.OpSetGlobal, 3),
+			},
+			expected: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0003
+				opcode.Make(opcode.OpJumpNotTruthy, 9),
+				// 0006
+				opcode.Make(opcode.OpGetGlobal, 1),
+				// 0009
+				opcode.Make(opcode.OpSetGlobal, 3),
+			},
+		},
+		{
+			input: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0003
+				opcode.Make(opcode.OpJumpNotTruthy, 11),
+				// 0006
+				opcode.Make(opcode.OpTrue),
+				// 0007
+				opcode.Make(opcode.OpPop),
+				// 0008
+				opcode.Make(opcode.OpGetGlobal, 1),
+				// 0011
+				opcode.Make(opcode.OpGetGlobal, 2),
+				// 0014
+				opcode.Make(opcode.OpPop),
+			},
+			expected: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0003
+				opcode.Make(opcode.OpJumpNotTruthy, 9),
+				// 0006
+				opcode.Make(opcode.OpGetGlobal, 1),
+				// 0009
+				opcode.Make(opcode.OpGetGlobal, 2),
+				// 0012
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpJump, 3),
+				// 0003
+				opcode.Make(opcode.OpJump, 0),
+			},
+			expected: []opcode.Instructions{
+				opcode.Make(opcode.OpJump, 3),
+				opcode.Make(opcode.OpJump, 0),
+			},
+		},
+		{
+			input: []opcode.Instructions{
+				{255},
+			},
+			expected: []opcode.Instructions{
+				{255},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		input := concatInstructions(tt.input)
+
+		err := testInstructions(tt.expected, Optimize(input))
+		if err != nil {
+			t.Errorf("testInstructions failed for\n%s: %s", input, err)
+		}
+	}
+}
+
+func TestPeepholeOption(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `if (true) { 10 } else { 20 }; 3333;`,
+			expectedConstants: []interface{}{10, 20, 3333},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: `function() { return 1; 2 }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]opcode.Instructions{
+					opcode.Make(opcode.OpConstant, 0),
+					opcode.Make(opcode.OpReturnValue),
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 2, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, Options{Peephole: true}, tests)
+}
@@ -1,11 +1,14 @@
 package compiler
 
+import "gocompiler/ir"
+
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "Global"
-	LocalScope  SymbolScope = "Local"
-	FreeScope   SymbolScope = "Free"
+	GlobalScope  SymbolScope = "Global"
+	LocalScope   SymbolScope = "Local"
+	FreeScope    SymbolScope = "Free"
+	BuiltinScope SymbolScope = "Builtin"
 )
 
 type Symbol struct {
@@ -19,12 +22,31 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+
+	// globals counts the global definitions of all modules, which share
+	// the globals of the VM. It is only used by global tables.
+	globals *int
 }
 
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
 	free := []Symbol{}
-	return &SymbolTable{store: s, FreeSymbols: free}
+	return &SymbolTable{store: s, FreeSymbols: free, globals: new(int)}
+}
+
+// NewModuleSymbolTable returns the global table of a module imported by the
+// program whose global table is main. The module has its own names, with
+// the builtins predefined, but its globals get indexes after those of main
+// and of every other module.
+func NewModuleSymbolTable(main *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.globals = main.globals
+
+	for i, builtin := range ir.Builtins {
+		s.DefineBuiltin(i, builtin.Name)
+	}
+
+	return s
 }
 
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
@@ -40,6 +62,8 @@ func (s *SymbolTable) Define(name string) Symbol {
 
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
+		symbol.Index = *s.globals
+		*s.globals++
 	} else {
 		symbol.Scope = LocalScope
 	}
@@ -50,6 +74,22 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return symbol
 }
 
+// DefineBuiltin defines name as the builtin with the given index. Builtins
+// don't take up a slot of the table's own definitions.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineImport defines name as another name for symbol, a global exported by
+// another module.
+func (s *SymbolTable) DefineImport(name string, symbol Symbol) Symbol {
+	symbol.Name = name
+	s.store[name] = symbol
+	return symbol
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -58,7 +98,7 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 			return obj, ok
 		}
 
-		if obj.Scope == GlobalScope {
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
 			return obj, ok
 		}
 
@@ -150,6 +150,39 @@ func TestResolveNestedLocal(t *testing.T) {
 	}
 }
 
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: BuiltinScope, Index: 1},
+		{Name: "e", Scope: BuiltinScope, Index: 2},
+	}
+
+	for i, v := range expected {
+		global.DefineBuiltin(i, v.Name)
+	}
+
+	for _, table := range []*SymbolTable{global, firstLocal, secondLocal} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+
+		if len(table.FreeSymbols) != 0 {
+			t.Errorf("builtins resolved as free symbols: %+v", table.FreeSymbols)
+		}
+	}
+}
+
 func TestResolveFree(t *testing.T) {
 	global := NewSymbolTable()
 	global.Define("a")
@@ -262,3 +295,36 @@ func TestResolveUnresolvableFree(t *testing.T) {
 		}
 	}
 }
+
+func TestModuleSymbolTable(t *testing.T) {
+	main := NewSymbolTable()
+	main.Define("a")
+
+	module := NewModuleSymbolTable(main)
+	b := module.Define("b")
+	if b != (Symbol{"b", GlobalScope, 1}) {
+		t.Errorf("wrong symbol for b: %+v", b)
+	}
+
+	c := main.Define("c")
+	if c != (Symbol{"c", GlobalScope, 2}) {
+		t.Errorf("wrong symbol for c: %+v", c)
+	}
+
+	if _, ok := module.Resolve("a"); ok {
+		t.Errorf("a of the main program resolved in the module")
+	}
+
+	if assert, ok := module.Resolve("assert"); !ok || assert.Scope != BuiltinScope {
+		t.Errorf("builtin assert not resolved in the module: %+v", assert)
+	}
+
+	imported := main.DefineImport("d", b)
+	if imported != (Symbol{"d", GlobalScope, 1}) {
+		t.Errorf("wrong symbol for d: %+v", imported)
+	}
+
+	if d, ok := main.Resolve("d"); !ok || d != imported {
+		t.Errorf("d resolved to %+v", d)
+	}
+}
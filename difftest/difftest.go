@@ -0,0 +1,146 @@
+// Package difftest runs programs through both the tree-walking evaluator
+// and the compiler and VM, and reports any difference in their results.
+package difftest
+
+import (
+	"fmt"
+
+	"gocompiler/ast"
+	"gocompiler/compiler"
+	"gocompiler/eval"
+	"gocompiler/ir"
+	"gocompiler/verifier"
+	"gocompiler/vm"
+)
+
+// Result is the outcome of running a program: a value or an error message.
+type Result struct {
+	Value ir.Object
+	Err   string
+}
+
+func (r Result) String() string {
+	if r.Err != "" {
+		return "error: " + r.Err
+	}
+
+	return r.Value.Inspect()
+}
+
+// allOptions lists every combination of compiler options, so that each
+// optimization is checked against the evaluator.
+var allOptions = []compiler.Options{
+	{},
+	{FoldConstants: true},
+	{Peephole: true},
+	{FoldConstants: true, Peephole: true},
+}
+
+// Check runs program through the evaluator and through the compiler and VM,
+// once for each combination of compiler options. It returns an error if the
+// compiler produces bytecode the verifier rejects or if any result differs
+// from the evaluator's.
+func Check(program *ast.Program) error {
+	want := Evaluate(program)
+
+	for _, options := range allOptions {
+		got, err := Execute(program, options)
+		if err != nil {
+			return fmt.Errorf("%+v: %s", options, err)
+		}
+
+		if !sameResult(want, got) {
+			return fmt.Errorf("%+v: evaluator gives %s, VM gives %s", options, want, got)
+		}
+	}
+
+	return nil
+}
+
+func Evaluate(program *ast.Program) Result {
+	obj := eval.Eval(program, ir.NewEnvironment())
+	if err, ok := obj.(*ir.Error); ok {
+		return Result{Err: err.Message}
+	}
+
+	return Result{Value: obj}
+}
+
+// Execute compiles program with the given options and runs it on the VM.
+// Compilation and runtime errors are part of the result; the error is only
+// for bytecode that fails verification.
+func Execute(program *ast.Program, options compiler.Options) (Result, error) {
+	comp := compiler.NewWithOptions(options)
+
+	err := comp.Compile(program)
+	if err != nil {
+		return Result{Err: err.Error()}, nil
+	}
+
+	bytecode := comp.Bytecode()
+
+	err = verifier.Verify(bytecode)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid bytecode: %s", err)
+	}
+
+	machine := vm.New(bytecode)
+
+	err = machine.Run()
+	if err != nil {
+		return Result{Err: err.Error()}, nil
+	}
+
+	return Result{Value: machine.LastPoppedStackElem()}, nil
+}
+
+func sameResult(a, b Result) bool {
+	if a.Err != "" || b.Err != "" {
+		return a.Err == b.Err
+	}
+
+	return sameValue(a.Value, b.Value)
+}
+
+// sameValue compares values from the evaluator with values from the VM.
+// Functions are represented differently by the two and only have to be
+// functions on both sides; hashes also have to agree on the order of keys.
+func sameValue(a, b ir.Object) bool {
+	switch a := a.(type) {
+	case *ir.Function:
+		_, ok := b.(*ir.Closure)
+		return ok
+	case *ir.Null:
+		_, ok := b.(*ir.Null)
+		return ok
+	case *ir.Array:
+		b, ok := b.(*ir.Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+
+		for i := range a.Elements {
+			if !sameValue(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+
+		return true
+	case *ir.Hash:
+		b, ok := b.(*ir.Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+
+		bPairs := b.Pairs()
+		for i, pair := range a.Pairs() {
+			if !ir.Equal(pair.Key, bPairs[i].Key) || !sameValue(pair.Value, bPairs[i].Value) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return b != nil && a.Type() == b.Type() && ir.Equal(a, b)
+	}
+}
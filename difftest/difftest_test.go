@@ -0,0 +1,56 @@
+package difftest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gocompiler/lexer"
+	"gocompiler/parser"
+)
+
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+
+	for _, file := range files {
+		input, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := parser.New(lexer.New(string(input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Errorf("%s: parser errors: %v", file, p.Errors())
+			continue
+		}
+
+		err = Check(program)
+		if err != nil {
+			t.Errorf("%s: %s", file, err)
+		}
+	}
+}
+
+func TestGeneratedPrograms(t *testing.T) {
+	n := 2000
+	if testing.Short() {
+		n = 200
+	}
+
+	for seed := int64(0); seed < int64(n); seed++ {
+		program := NewGenerator(seed).Program()
+
+		err := Check(program)
+		if err != nil {
+			t.Errorf("seed %d: %s\nprogram: %s", seed, err, program)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package difftest
+
+import (
+	"math/rand"
+	"strconv"
+
+	"gocompiler/ast"
+	"gocompiler/token"
+)
+
+type kind int
+
+const (
+	intKind kind = iota
+	boolKind
+	stringKind
+	arrayKind
+	hashKind
+	numKinds
+)
+
+// maxDepth bounds how deeply generated expressions nest.
+const maxDepth = 5
+
+// illTyped is the chance, in percent, that an operand has a random kind
+// instead of the one its operator expects. Such programs exercise the
+// error paths of both implementations.
+const illTyped = 1
+
+// nullish is the chance, in percent, that an if expression, a block or a
+// function body is built so that it gives null. Null spreads into runtime
+// errors quickly, so this is kept low.
+const nullish = 4
+
+type variable struct {
+	name string
+	kind kind
+
+	// For functions: the number of (integer) parameters and the kind of
+	// the result. Function variables are only ever called.
+	function bool
+	params   int
+}
+
+// Generator produces random programs that parse, compile and terminate.
+// Names are never redefined and are only used after their definition and
+// inside the block that defines them, so that the compiler's static
+// scoping and the evaluator's environments agree on every lookup. Runtime
+// errors, such as division by zero or adding a string to an integer, are
+// left in on purpose.
+type Generator struct {
+	rand   *rand.Rand
+	depth  int
+	names  int
+	scopes [][]variable
+}
+
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Program returns a new random program. It always ends with an expression
+// statement, whose value is the result of the program.
+func (g *Generator) Program() *ast.Program {
+	g.depth = 0
+	g.scopes = [][]variable{nil}
+
+	program := &ast.Program{}
+
+	for i := g.rand.Intn(6); i > 0; i-- {
+		program.Statements = append(program.Statements, g.statement(nil))
+	}
+
+	program.Statements = append(program.Statements, expressionStatement(g.expression(g.randomKind())))
+
+	return program
+}
+
+// statement returns a random statement. Inside a function, result is the
+// kind the function returns.
+func (g *Generator) statement(result *kind) ast.Statement {
+	switch n := g.rand.Intn(10); {
+	case n < 5:
+		return g.let()
+	case n < 7 && result != nil:
+		return g.returnIf(*result)
+	default:
+		return expressionStatement(g.expression(g.randomKind()))
+	}
+}
+
+func (g *Generator) let() ast.Statement {
+	v := variable{name: g.newName("v"), kind: g.randomKind()}
+
+	var value ast.Expression
+	if g.rand.Intn(4) == 0 {
+		v.function = true
+		v.params = g.rand.Intn(3)
+		value = g.function(v.kind, v.params)
+	} else {
+		value = g.expression(v.kind)
+	}
+
+	g.define(v)
+
+	return &ast.LetStatement{
+		Token: token.Token{Type: token.Let, Literal: "let"},
+		Name:  identifier(v.name),
+		Value: value,
+	}
+}
+
+// returnIf returns if (condition) { return value; }, to check returns from
+// nested blocks.
+func (g *Generator) returnIf(result kind) ast.Statement {
+	ret := &ast.ReturnStatement{
+		Token:       token.Token{Type: token.Return, Literal: "return"},
+		ReturnValue: g.expression(result),
+	}
+
+	return expressionStatement(&ast.IfExpression{
+		Token:       token.Token{Type: token.If, Literal: "if"},
+		Condition:   g.expression(boolKind),
+		Consequence: block(ret),
+	})
+}
+
+func (g *Generator) function(result kind, params int) *ast.FunctionLiteral {
+	g.depth++
+	defer func() { g.depth-- }()
+
+	g.scopes = append(g.scopes, nil)
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+
+	fn := &ast.FunctionLiteral{Token: token.Token{Type: token.Function, Literal: "function"}}
+
+	for i := 0; i < params; i++ {
+		param := variable{name: g.newName("p"), kind: intKind}
+		fn.Parameters = append(fn.Parameters, identifier(param.name))
+		g.define(param)
+	}
+
+	var statements []ast.Statement
+	for i := g.rand.Intn(3); i > 0; i-- {
+		statements = append(statements, g.statement(&result))
+	}
+
+	// The function ends with an expression statement, a return statement,
+	// or, now and then, nothing that produces a value.
+	switch {
+	case g.rand.Intn(100) < nullish:
+	case g.rand.Intn(10) == 0:
+		statements = append(statements, &ast.ReturnStatement{
+			Token:       token.Token{Type: token.Return, Literal: "return"},
+			ReturnValue: g.expression(result),
+		})
+	default:
+		statements = append(statements, expressionStatement(g.expression(result)))
+	}
+
+	fn.Body = block(statements...)
+
+	return fn
+}
+
+func (g *Generator) expression(k kind) ast.Expression {
+	if g.rand.Intn(100) < illTyped {
+		k = g.randomKind()
+	}
+
+	if g.depth >= maxDepth || g.rand.Intn(4) == 0 {
+		return g.leaf(k)
+	}
+
+	g.depth++
+	defer func() { g.depth-- }()
+
+	switch n := g.rand.Intn(10); {
+	case n == 0:
+		return g.ifExpression(k)
+	case n == 1:
+		if call, ok := g.call(k); ok {
+			return call
+		}
+	case n == 2:
+		// An immediately called function literal.
+		params := g.rand.Intn(2)
+		return g.callExpression(g.function(k, params), params)
+	}
+
+	switch k {
+	case intKind:
+		switch g.rand.Intn(8) {
+		case 0:
+			return prefix("-", g.expression(intKind))
+		case 1:
+			return g.index()
+		case 2:
+			// Mostly a divisor that can't be zero.
+			if g.rand.Intn(4) != 0 {
+				return infix("/", g.expression(intKind), integer(int64(g.rand.Intn(3)+1)))
+			}
+			return infix("/", g.expression(intKind), g.expression(intKind))
+		default:
+			return infix(g.choose("+", "-", "*"), g.expression(intKind), g.expression(intKind))
+		}
+	case boolKind:
+		switch g.rand.Intn(5) {
+		case 0:
+			return prefix("!", g.expression(boolKind))
+		case 1:
+			operand := g.randomKind()
+			return infix(g.choose("==", "!="), g.expression(operand), g.expression(operand))
+		case 2:
+			return infix(g.choose("<", ">", "==", "!="), g.expression(stringKind), g.expression(stringKind))
+		default:
+			return infix(g.choose("<", ">", "==", "!="), g.expression(intKind), g.expression(intKind))
+		}
+	case stringKind:
+		switch g.rand.Intn(4) {
+		case 0:
+			return g.slice(stringKind)
+		case 1:
+			return g.interpolatedString()
+		default:
+			return infix("+", g.expression(stringKind), g.expression(stringKind))
+		}
+	case arrayKind:
+		if g.rand.Intn(3) == 0 {
+			return g.slice(arrayKind)
+		}
+		return g.arrayLiteral()
+	default:
+		return g.hashLiteral()
+	}
+}
+
+func (g *Generator) leaf(k kind) ast.Expression {
+	if v, ok := g.lookup(k, false); ok && g.rand.Intn(2) == 0 {
+		return identifier(v.name)
+	}
+
+	switch k {
+	case intKind:
+		return g.smallInteger()
+	case boolKind:
+		return boolean(g.rand.Intn(2) == 0)
+	case stringKind:
+		return stringLiteral(g.choose("", "a", "monkey", "héllo", "世界"))
+	case arrayKind:
+		return &ast.ArrayLiteral{Token: token.Token{Type: token.LeftBracket, Literal: "["}}
+	default:
+		return &ast.HashLiteral{Token: token.Token{Type: token.LeftBrace, Literal: "{"}}
+	}
+}
+
+func (g *Generator) ifExpression(k kind) ast.Expression {
+	ie := &ast.IfExpression{
+		Token:       token.Token{Type: token.If, Literal: "if"},
+		Condition:   g.expression(boolKind),
+		Consequence: g.block(k),
+	}
+
+	// Without an alternative, the value may be null.
+	if g.rand.Intn(100) >= nullish {
+		ie.Alternative = g.block(k)
+	}
+
+	return ie
+}
+
+// block returns a block ending with an expression of kind k, or sometimes
+// with a let statement or nothing at all, which give null.
+func (g *Generator) block(k kind) *ast.BlockStatement {
+	g.scopes = append(g.scopes, nil)
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+
+	var statements []ast.Statement
+	if g.rand.Intn(4) == 0 {
+		statements = append(statements, g.let())
+	}
+
+	if g.rand.Intn(100) >= nullish {
+		statements = append(statements, expressionStatement(g.expression(k)))
+	}
+
+	return block(statements...)
+}
+
+func (g *Generator) call(k kind) (ast.Expression, bool) {
+	v, ok := g.lookup(k, true)
+	if !ok {
+		return nil, false
+	}
+
+	return g.callExpression(identifier(v.name), v.params), true
+}
+
+func (g *Generator) callExpression(function ast.Expression, params int) ast.Expression {
+	call := &ast.CallExpression{
+		Token:    token.Token{Type: token.LeftParen, Literal: "("},
+		Function: function,
+	}
+
+	for i := 0; i < params; i++ {
+		call.Arguments = append(call.Arguments, g.expression(intKind))
+	}
+
+	return call
+}
+
+// index returns an index expression for an integer. Most of the time the
+// element exists; otherwise the result is null.
+func (g *Generator) index() ast.Expression {
+	index := &ast.IndexExpression{Token: token.Token{Type: token.LeftBracket, Literal: "["}}
+
+	switch n := g.rand.Intn(10); {
+	case n == 0:
+		index.Left, index.Index = g.expression(arrayKind), integer(0)
+	case n == 1:
+		index.Left, index.Index = g.expression(hashKind), g.hashKey()
+	case n < 6:
+		array := g.arrayLiteral().(*ast.ArrayLiteral)
+		array.Elements = append(array.Elements, g.expression(intKind))
+		index.Left, index.Index = array, integer(int64(len(array.Elements)-1))
+	default:
+		key := g.hashKey()
+		hash := g.hashLiteral().(*ast.HashLiteral)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: g.expression(intKind)})
+		index.Left, index.Index = hash, key
+	}
+
+	return index
+}
+
+func (g *Generator) slice(k kind) ast.Expression {
+	se := &ast.SliceExpression{
+		Token: token.Token{Type: token.LeftBracket, Literal: "["},
+		Left:  g.expression(k),
+	}
+
+	// Mostly bounds that are in range for short operands.
+	if g.rand.Intn(2) == 0 {
+		se.Low = integer(int64(g.rand.Intn(2)))
+	}
+	if g.rand.Intn(3) == 0 {
+		se.High = g.smallInteger()
+	}
+
+	return se
+}
+
+func (g *Generator) interpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: token.Token{Type: token.StringStart, Literal: "a"}}
+
+	for i := g.rand.Intn(3) + 1; i > 0; i-- {
+		str.Parts = append(str.Parts, stringLiteral(g.choose("a", " ", "ё")))
+		str.Parts = append(str.Parts, g.expression(g.randomKind()))
+	}
+
+	return str
+}
+
+func (g *Generator) arrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: token.Token{Type: token.LeftBracket, Literal: "["}}
+
+	for i := g.rand.Intn(4); i > 0; i-- {
+		array.Elements = append(array.Elements, g.expression(intKind))
+	}
+
+	return array
+}
+
+func (g *Generator) hashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: token.Token{Type: token.LeftBrace, Literal: "{"}}
+
+	for i := g.rand.Intn(4); i > 0; i-- {
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: g.hashKey(), Value: g.expression(intKind)})
+	}
+
+	return hash
+}
+
+func (g *Generator) hashKey() ast.Expression {
+	if g.rand.Intn(2) == 0 {
+		return g.smallInteger()
+	}
+
+	return stringLiteral(g.choose("a", "b", "c"))
+}
+
+func (g *Generator) smallInteger() ast.Expression {
+	value := int64(g.rand.Intn(7) - 2)
+	if value < 0 {
+		return prefix("-", integer(-value))
+	}
+
+	return integer(value)
+}
+
+func (g *Generator) randomKind() kind {
+	return kind(g.rand.Intn(int(numKinds)))
+}
+
+func (g *Generator) choose(options ...string) string {
+	return options[g.rand.Intn(len(options))]
+}
+
+func (g *Generator) define(v variable) {
+	last := len(g.scopes) - 1
+	g.scopes[last] = append(g.scopes[last], v)
+}
+
+// lookup returns a random visible variable of kind k.
+func (g *Generator) lookup(k kind, function bool) (variable, bool) {
+	var candidates []variable
+	for _, scope := range g.scopes {
+		for _, v := range scope {
+			if v.kind == k && v.function == function {
+				candidates = append(candidates, v)
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return variable{}, false
+	}
+
+	return candidates[g.rand.Intn(len(candidates))], true
+}
+
+// newName returns a fresh identifier. Identifiers can't contain digits, so
+// the counter is spelled with letters.
+func (g *Generator) newName(prefix string) string {
+	g.names++
+
+	name := []byte(prefix)
+	for _, digit := range strconv.Itoa(g.names) {
+		name = append(name, byte('a'+digit-'0'))
+	}
+
+	return string(name)
+}
+
+func expressionStatement(exp ast.Expression) *ast.ExpressionStatement {
+	return &ast.ExpressionStatement{Token: token.Token{Literal: exp.TokenLiteral()}, Expression: exp}
+}
+
+func block(statements ...ast.Statement) *ast.BlockStatement {
+	return &ast.BlockStatement{
+		Token:      token.Token{Type: token.LeftBrace, Literal: "{"},
+		Statements: statements,
+	}
+}
+
+func identifier(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.Identifier, Literal: name}, Value: name}
+}
+
+func integer(value int64) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.Int, Literal: literal}, Value: value}
+}
+
+func stringLiteral(value string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: token.Token{Type: token.String, Literal: value}, Value: value}
+}
+
+func boolean(value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: token.Token{Type: token.True, Literal: "true"}, Value: true}
+	}
+
+	return &ast.Boolean{Token: token.Token{Type: token.False, Literal: "false"}, Value: false}
+}
+
+func prefix(operator string, right ast.Expression) *ast.PrefixExpression {
+	return &ast.PrefixExpression{
+		Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+		Operator: operator,
+		Right:    right,
+	}
+}
+
+func infix(operator string, left, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{
+		Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+		Operator: operator,
+		Left:     left,
+		Right:    right,
+	}
+}
@@ -0,0 +1,8 @@
+let double = function(x) { x * 2 };
+
+assert(double(2) == 4, "double");
+assert_eq([double(1), "a"], [2, "a"]);
+assert_error(function() { double("a") });
+assert_error(function() { 1 / 0 }, "division by zero");
+
+assert_eq(double(3), 7);
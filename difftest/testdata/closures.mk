@@ -0,0 +1,14 @@
+let newAdder = function(a) {
+    function(b) { function(c) { a + b + c } }
+};
+
+let counter = function(start) {
+    let next = function(n) { counter(n + 1) };
+    [start, next]
+};
+
+let adder = newAdder(1)(2);
+let pair = counter(10);
+let third = pair[1](pair[0])[1](11);
+
+[adder(3), third[0], newAdder(-1)(-2)(-3)]
@@ -0,0 +1,24 @@
+let array = [1, 2, 3, 4, 5];
+let hash = {"one": 1, 2: "two", true: [3], "four": {4: 4}};
+
+[
+    array[0],
+    array[4],
+    array[5],
+    array[-1],
+    array[1:3],
+    array[:-2],
+    array[-2:],
+    array[3:1],
+    array[array[5]:2],
+    array[1:array[5]],
+    hash["one"],
+    hash[2],
+    hash[true][0],
+    hash["four"][4],
+    hash["missing"],
+    {"b": 1, "a": 2, "b": 3},
+    [1, [2, 3]] == [1, [2, 3]],
+    {1: 2, 3: 4} == {3: 4, 1: 2},
+    [1, 2] != [1, 2, 3]
+]
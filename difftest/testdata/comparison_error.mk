@@ -0,0 +1 @@
+true < [1];
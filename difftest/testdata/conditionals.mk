@@ -0,0 +1,17 @@
+let classify = function(n) {
+    if (n < 0) {
+        return "negative";
+    }
+    if (n == 0) { "zero" } else {
+        if (n > 100) { "large" } else { "small" }
+    }
+};
+
+let nothing = function(c) {
+    if (c) { let x = 1; } else { }
+};
+
+let empty = if (false) { 1 };
+let unused = if (true) { };
+
+[classify(-5), classify(0), classify(5), classify(500), nothing(true), nothing(false), empty, unused]
@@ -0,0 +1,3 @@
+let divide = function(a, b) { a / b };
+
+divide(10, 5) + divide(1, 1 - 1);
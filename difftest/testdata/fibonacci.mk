@@ -0,0 +1,8 @@
+let fibonacci = function(x) {
+    if (x < 2) {
+        return x;
+    }
+    fibonacci(x - 1) + fibonacci(x - 2);
+};
+
+[fibonacci(0), fibonacci(1), fibonacci(10), fibonacci(15)]
@@ -0,0 +1,12 @@
+let reduce = function(array, initial, f) {
+    if (array == []) {
+        return initial;
+    }
+    reduce(array[1:], f(initial, array[0]), f);
+};
+
+let sum = function(array) { reduce(array, 0, function(a, b) { a + b }) };
+
+let countdown = function(n) { if (n == 0) { "done" } else { countdown(n - 1) } };
+
+[sum([1, 2, 3, 4, 5]) + sum([10, 20]), countdown(1000)]
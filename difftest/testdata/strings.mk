@@ -0,0 +1,17 @@
+let name = "мир";
+let greeting = "hello, ${name}!";
+let s = "héllo, 世界";
+
+[
+    greeting,
+    s[1],
+    s[-2:],
+    s[:5],
+    s[7:9],
+    s[20:],
+    "a" < "b",
+    "b" < "a",
+    "abc" == "ab" + "c",
+    "${1 + 2}${true}${[1, "x"]}${ {"k": 2} }${if (false) { 1 }}",
+    "nested ${"inner ${name}"}"
+]
@@ -0,0 +1,3 @@
+let f = function(x) { if (x > 0) { x } else { "negative" } };
+
+f(1) + f(-1);
@@ -0,0 +1,2 @@
+let f = function(a, b) { a + b };
+f(1);
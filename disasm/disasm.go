@@ -0,0 +1,200 @@
+// Package disasm prints compiled programs in a readable form.
+//
+// The listing starts with the constant pool, followed by the main program
+// and every compiled function of the pool:
+//
+//	.constant 0 integer 10
+//	.constant 1 string "ten"
+//
+//	.main
+//	0000 OpGetGlobal 0
+//	0003 OpJumpNotTruthy L1
+//	0006 OpConstant 0 ; 10
+//	0009 OpJump L2
+//	L1:
+//	0012 OpConstant 1 ; "ten"
+//	L2:
+//	0015 OpPop
+//
+//	.function 2 locals=1 params=1
+//	0000 OpGetLocal 0
+//	0002 OpReturnValue
+//
+// Jump targets are replaced with labels and OpConstant is annotated with the
+// value it loads. Bytes that don't form a valid instruction are printed as
+// .byte directives.
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gocompiler/compiler"
+	"gocompiler/ir"
+	"gocompiler/opcode"
+)
+
+func Disassemble(bytecode *compiler.Bytecode) string {
+	var out bytes.Buffer
+
+	for i, c := range bytecode.Constants {
+		if _, ok := c.(*ir.CompiledFunction); ok {
+			continue
+		}
+
+		_, _ = fmt.Fprintf(&out, ".constant %d %s\n", i, Constant(c))
+	}
+
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+
+	out.WriteString(".main\n")
+	out.WriteString(Instructions(bytecode.Instructions, bytecode.Constants))
+
+	for i, c := range bytecode.Constants {
+		fn, ok := c.(*ir.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		_, _ = fmt.Fprintf(&out, "\n.function %d locals=%d params=%d\n", i, fn.NumLocals, fn.NumParameters)
+		out.WriteString(Instructions(fn.Instructions, bytecode.Constants))
+	}
+
+	return out.String()
+}
+
+// Constant formats a constant as its type followed by its value.
+func Constant(obj ir.Object) string {
+	switch obj := obj.(type) {
+	case *ir.Integer:
+		return "integer " + constantValue(obj)
+	case *ir.String:
+		return "string " + constantValue(obj)
+	default:
+		return fmt.Sprintf("unsupported ; %s", obj.Type())
+	}
+}
+
+func constantValue(obj ir.Object) string {
+	switch obj := obj.(type) {
+	case *ir.Integer:
+		return strconv.FormatInt(obj.Value, 10)
+	case *ir.String:
+		return strconv.Quote(obj.Value)
+	default:
+		return string(obj.Type())
+	}
+}
+
+type instruction struct {
+	offset   int
+	op       opcode.Opcode
+	def      *opcode.Definition
+	operands []int
+	raw      []byte
+}
+
+// Instructions lists ins with labelled jumps. constants are used to annotate
+// OpConstant and may be nil.
+func Instructions(ins opcode.Instructions, constants []ir.Object) string {
+	var decoded []instruction
+	boundaries := make(map[int]bool)
+
+	for offset := 0; offset < len(ins); {
+		boundaries[offset] = true
+
+		def, err := opcode.Lookup(ins[offset])
+		if err != nil || offset+1+def.Width() > len(ins) {
+			decoded = append(decoded, instruction{offset: offset, raw: ins[offset : offset+1]})
+			offset++
+			continue
+		}
+
+		operands, read := opcode.ReadOperands(def, ins[offset+1:])
+		decoded = append(decoded, instruction{
+			offset:   offset,
+			op:       opcode.Opcode(ins[offset]),
+			def:      def,
+			operands: operands,
+		})
+
+		offset += read + 1
+	}
+	boundaries[len(ins)] = true
+
+	labels := make(map[int]string)
+	var targets []int
+
+	for _, in := range decoded {
+		if in.def == nil || !isJump(in.op) {
+			continue
+		}
+
+		target := in.operands[0]
+		if boundaries[target] && labels[target] == "" {
+			labels[target] = "?"
+			targets = append(targets, target)
+		}
+	}
+
+	sort.Ints(targets)
+	for i, target := range targets {
+		labels[target] = fmt.Sprintf("L%d", i+1)
+	}
+
+	var out bytes.Buffer
+
+	for _, in := range decoded {
+		if label, ok := labels[in.offset]; ok {
+			_, _ = fmt.Fprintf(&out, "%s:\n", label)
+		}
+
+		_, _ = fmt.Fprintf(&out, "%04d %s\n", in.offset, formatInstruction(in, labels, constants))
+	}
+
+	if label, ok := labels[len(ins)]; ok {
+		_, _ = fmt.Fprintf(&out, "%s:\n", label)
+	}
+
+	return out.String()
+}
+
+func isJump(op opcode.Opcode) bool {
+	return op == opcode.OpJump || op == opcode.OpJumpNotTruthy
+}
+
+func formatInstruction(in instruction, labels map[int]string, constants []ir.Object) string {
+	if in.def == nil {
+		comment := "truncated instruction"
+		if _, err := opcode.Lookup(in.raw[0]); err != nil {
+			comment = err.Error()
+		}
+
+		return fmt.Sprintf(".byte %d ; %s", in.raw[0], comment)
+	}
+
+	parts := []string{in.def.Name}
+
+	for _, o := range in.operands {
+		parts = append(parts, strconv.Itoa(o))
+	}
+
+	if isJump(in.op) {
+		if label, ok := labels[in.operands[0]]; ok {
+			parts[1] = label
+		} else {
+			parts = append(parts, "; invalid jump target")
+		}
+	}
+
+	if (in.op == opcode.OpConstant || in.op == opcode.OpConstantWide) && in.operands[0] < len(constants) {
+		parts = append(parts, "; "+constantValue(constants[in.operands[0]]))
+	}
+
+	return strings.Join(parts, " ")
+}
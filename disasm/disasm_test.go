@@ -0,0 +1,98 @@
+package disasm
+
+import (
+	"testing"
+
+	"gocompiler/compiler"
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/opcode"
+	"gocompiler/parser"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `
+	let ten = function(x) { if (x) { 10 } else { "ten" } };
+	ten(true);
+	`
+
+	expected := `.constant 0 integer 10
+.constant 1 string "ten"
+
+.main
+0000 OpClosure 2 0
+0004 OpSetGlobal 0
+0007 OpGetGlobal 0
+0010 OpTrue
+0011 OpCall 1
+0013 OpPop
+
+.function 2 locals=1 params=1
+0000 OpGetLocal 0
+0002 OpJumpNotTruthy L1
+0005 OpConstant 0 ; 10
+0008 OpJump L2
+L1:
+0011 OpConstant 1 ; "ten"
+L2:
+0014 OpReturnValue
+`
+
+	p := parser.New(lexer.New(input))
+	comp := compiler.New()
+
+	err := comp.Compile(p.ParseProgram())
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	actual := Disassemble(comp.Bytecode())
+	if actual != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func TestDisassembleMalformed(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: concat(
+			// 0000
+			opcode.Make(opcode.OpJump, 5),
+			// 0003
+			opcode.Instructions{255},
+			// 0004
+			opcode.Make(opcode.OpJump, 10),
+			// 0007
+			opcode.Make(opcode.OpConstant, 7),
+			// 0010
+			opcode.Instructions{byte(opcode.OpConstant), 0},
+		),
+		Constants: []ir.Object{&ir.CompiledFunction{Instructions: opcode.Instructions{}}},
+	}
+
+	expected := `.main
+0000 OpJump 5 ; invalid jump target
+0003 .byte 255 ; opcode 255 undefined
+0004 OpJump L1
+0007 OpConstant 7
+L1:
+0010 .byte 0 ; truncated instruction
+0011 .byte 0 ; truncated instruction
+
+.function 0 locals=0 params=0
+`
+
+	actual := Disassemble(bytecode)
+	if actual != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, actual)
+	}
+}
+
+func concat(s ...opcode.Instructions) opcode.Instructions {
+	out := opcode.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
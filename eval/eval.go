@@ -0,0 +1,552 @@
+// Package eval interprets programs by walking their AST. It implements the
+// same language as the compiler and the VM, and serves as a reference for
+// both.
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"gocompiler/ast"
+	"gocompiler/ir"
+)
+
+// MaxDepth is how deeply function calls may nest, matching the VM's default
+// limit on frames.
+const MaxDepth = 1 << 16
+
+var (
+	True  = &ir.Boolean{Value: true}
+	False = &ir.Boolean{Value: false}
+	Null  = &ir.Null{}
+)
+
+type evaluator struct {
+	depth int
+}
+
+// Eval evaluates node in env. Runtime errors are returned as *ir.Error.
+// Statements that don't produce a value, such as let statements, give nil.
+func Eval(node ast.Node, env *ir.Environment) ir.Object {
+	e := &evaluator{}
+	return e.eval(node, env)
+}
+
+func (e *evaluator) eval(node ast.Node, env *ir.Environment) ir.Object {
+	switch node := node.(type) {
+	case *ast.Program:
+		return e.evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return e.eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node, env)
+	case *ast.LetStatement:
+		val := e.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		env.Set(node.Name.Value, val)
+		return nil
+	case *ast.ReturnStatement:
+		val := e.eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+
+		return &ir.ReturnValue{Value: val}
+	case *ast.ExportStatement:
+		return e.eval(node.Statement, env)
+	case *ast.ImportStatement:
+		return newError("cannot import %q: the evaluator doesn't support modules", node.Path)
+	case *ast.Identifier:
+		val, ok := env.Get(node.Value)
+		if ok {
+			return val
+		}
+
+		if builtin := ir.LookupBuiltin(node.Value); builtin != nil {
+			return builtin
+		}
+
+		return newError("undefined variable %s", node.Value)
+	case *ast.IntegerLiteral:
+		return &ir.Integer{Value: node.Value}
+	case *ast.StringLiteral:
+		return &ir.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.InterpolatedString:
+		return e.evalInterpolatedString(node, env)
+	case *ast.PrefixExpression:
+		right := e.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+
+		return evalPrefixExpression(node.Operator, right)
+	case *ast.InfixExpression:
+		// a < b means b > a, with b evaluated first, as in the compiler.
+		if node.Operator == "<" {
+			return e.evalInfix(">", node.Right, node.Left, env)
+		}
+
+		return e.evalInfix(node.Operator, node.Left, node.Right, env)
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env)
+	case *ast.FunctionLiteral:
+		return &ir.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.MacroLiteral:
+		return newError("unexpanded macro literal")
+	case *ast.CallExpression:
+		if isQuote(node) {
+			return e.quote(node.Arguments, env)
+		}
+
+		function := e.eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		return e.applyFunction(function, args)
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+
+		return &ir.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return e.evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := e.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := e.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(node, env)
+	default:
+		return newError("unknown node %T", node)
+	}
+}
+
+// evalProgram returns the value of the last statement that produced one.
+func (e *evaluator) evalProgram(program *ast.Program, env *ir.Environment) ir.Object {
+	var result ir.Object = Null
+
+	for _, statement := range program.Statements {
+		val := e.eval(statement, env)
+
+		switch val := val.(type) {
+		case *ir.ReturnValue:
+			return val.Value
+		case *ir.Error:
+			return val
+		case nil:
+		default:
+			result = val
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement returns the value of the block's last statement, or
+// null if that statement doesn't produce a value. Return values and errors
+// are passed up unchanged, so that they stop enclosing blocks too.
+func (e *evaluator) evalBlockStatement(block *ast.BlockStatement, env *ir.Environment) ir.Object {
+	var result ir.Object
+
+	for _, statement := range block.Statements {
+		result = e.eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == ir.ReturnValueObj || rt == ir.ErrorObj {
+				return result
+			}
+		}
+	}
+
+	if result == nil {
+		return Null
+	}
+
+	return result
+}
+
+func (e *evaluator) evalInfix(operator string, leftExp, rightExp ast.Expression, env *ir.Environment) ir.Object {
+	left := e.eval(leftExp, env)
+	if isError(left) {
+		return left
+	}
+
+	right := e.eval(rightExp, env)
+	if isError(right) {
+		return right
+	}
+
+	return evalInfixExpression(operator, left, right)
+}
+
+func (e *evaluator) evalIfExpression(ie *ast.IfExpression, env *ir.Environment) ir.Object {
+	condition := e.eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return e.eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return e.eval(ie.Alternative, env)
+	}
+
+	return Null
+}
+
+func (e *evaluator) evalExpressions(exps []ast.Expression, env *ir.Environment) []ir.Object {
+	result := make([]ir.Object, 0, len(exps))
+
+	for _, exp := range exps {
+		evaluated := e.eval(exp, env)
+		if isError(evaluated) {
+			return []ir.Object{evaluated}
+		}
+
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func (e *evaluator) evalInterpolatedString(is *ast.InterpolatedString, env *ir.Environment) ir.Object {
+	var out strings.Builder
+
+	for _, part := range is.Parts {
+		val := e.eval(part, env)
+		if isError(val) {
+			return val
+		}
+
+		out.WriteString(val.Inspect())
+	}
+
+	return &ir.String{Value: out.String()}
+}
+
+func (e *evaluator) evalHashLiteral(node *ast.HashLiteral, env *ir.Environment) ir.Object {
+	var keys, values []ir.Object
+
+	for _, pair := range node.Pairs {
+		key := e.eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		value := e.eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	// Keys are checked only once all pairs are evaluated, as in the VM.
+	hash := ir.NewHash()
+	for i, key := range keys {
+		hashKey, ok := key.(ir.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey, values[i])
+	}
+
+	return hash
+}
+
+func (e *evaluator) applyFunction(fn ir.Object, args []ir.Object) ir.Object {
+	if builtin, ok := fn.(*ir.Builtin); ok {
+		result, err := builtin.Fn(e, args...)
+		if err != nil {
+			return newError("%s", err)
+		}
+
+		if result == nil {
+			return Null
+		}
+
+		return result
+	}
+
+	function, ok := fn.(*ir.Function)
+	if !ok {
+		return newError("not a function: %s", fn.Type())
+	}
+
+	if len(args) != len(function.Parameters) {
+		return newError("wrong number of arguments: want=%d, got=%d",
+			len(function.Parameters), len(args))
+	}
+
+	if e.depth >= MaxDepth {
+		return newError("stack overflow: MaxDepth (%d) exceeded", MaxDepth)
+	}
+
+	env := ir.NewEnclosedEnvironment(function.Env)
+	for i, param := range function.Parameters {
+		env.Set(param.Value, args[i])
+	}
+
+	e.depth++
+	evaluated := e.eval(function.Body, env)
+	e.depth--
+
+	if returnValue, ok := evaluated.(*ir.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return evaluated
+}
+
+// Call calls fn for a builtin, with errors returned as Go errors.
+func (e *evaluator) Call(fn ir.Object, args ...ir.Object) (ir.Object, error) {
+	result := e.applyFunction(fn, args)
+	if err, ok := result.(*ir.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+
+	return result, nil
+}
+
+// FS returns nil: the evaluator doesn't let programs read files.
+func (e *evaluator) FS() fs.FS {
+	return nil
+}
+
+func evalPrefixExpression(operator string, right ir.Object) ir.Object {
+	switch operator {
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "-":
+		integer, ok := right.(*ir.Integer)
+		if !ok {
+			return newError("unsupported type for negation: %s", right.Type())
+		}
+
+		return &ir.Integer{Value: -integer.Value}
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalInfixExpression(operator string, left, right ir.Object) ir.Object {
+	switch {
+	case left.Type() == ir.IntegerObj && right.Type() == ir.IntegerObj:
+		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == ir.StringObj && right.Type() == ir.StringObj:
+		return evalStringInfixExpression(operator, left, right)
+	case operator == "==":
+		return nativeBoolToBooleanObject(ir.Equal(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!ir.Equal(left, right))
+	case operator == "+" || operator == "-" || operator == "*" || operator == "/":
+		return newError("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left, right ir.Object) ir.Object {
+	leftValue := left.(*ir.Integer).Value
+	rightValue := right.(*ir.Integer).Value
+
+	switch operator {
+	case "+":
+		return &ir.Integer{Value: leftValue + rightValue}
+	case "-":
+		return &ir.Integer{Value: leftValue - rightValue}
+	case "*":
+		return &ir.Integer{Value: leftValue * rightValue}
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		return &ir.Integer{Value: leftValue / rightValue}
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalStringInfixExpression(operator string, left, right ir.Object) ir.Object {
+	leftValue := left.(*ir.String).Value
+	rightValue := right.(*ir.String).Value
+
+	switch operator {
+	case "+":
+		return &ir.String{Value: leftValue + rightValue}
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIndexExpression(left, index ir.Object) ir.Object {
+	switch {
+	case left.Type() == ir.ArrayObj && index.Type() == ir.IntegerObj:
+		elements := left.(*ir.Array).Elements
+		i := index.(*ir.Integer).Value
+
+		if i < 0 || i >= int64(len(elements)) {
+			return Null
+		}
+
+		return elements[i]
+	case left.Type() == ir.StringObj && index.Type() == ir.IntegerObj:
+		runes := []rune(left.(*ir.String).Value)
+		i := index.(*ir.Integer).Value
+
+		if i < 0 || i >= int64(len(runes)) {
+			return Null
+		}
+
+		return &ir.String{Value: string(runes[i])}
+	case left.Type() == ir.HashObj:
+		key, ok := index.(ir.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		value, ok := left.(*ir.Hash).Get(key)
+		if !ok {
+			return Null
+		}
+
+		return value
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// evalSliceExpression slices arrays by element and strings by rune.
+// Negative bounds count from the end and null ones count as omitted, as in
+// the VM; bounds out of range give null.
+func (e *evaluator) evalSliceExpression(se *ast.SliceExpression, env *ir.Environment) ir.Object {
+	left := e.eval(se.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	var length int
+	switch left := left.(type) {
+	case *ir.Array:
+		length = len(left.Elements)
+	case *ir.String:
+		length = len([]rune(left.Value))
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	low, err := e.evalSliceBound(se.Low, env, 0, length)
+	if err != nil {
+		return err
+	}
+
+	high, err := e.evalSliceBound(se.High, env, int64(length), length)
+	if err != nil {
+		return err
+	}
+
+	if low < 0 || high > int64(length) || low > high {
+		return Null
+	}
+
+	switch left := left.(type) {
+	case *ir.Array:
+		elements := make([]ir.Object, high-low)
+		copy(elements, left.Elements[low:high])
+		return &ir.Array{Elements: elements}
+	default:
+		runes := []rune(left.(*ir.String).Value)
+		return &ir.String{Value: string(runes[low:high])}
+	}
+}
+
+func (e *evaluator) evalSliceBound(exp ast.Expression, env *ir.Environment, omitted int64, length int) (int64, *ir.Error) {
+	if exp == nil {
+		return omitted, nil
+	}
+
+	val := e.eval(exp, env)
+	if err, ok := val.(*ir.Error); ok {
+		return 0, err
+	}
+
+	if val == Null {
+		return omitted, nil
+	}
+
+	integer, ok := val.(*ir.Integer)
+	if !ok {
+		return 0, newError("slice bound must be %s, got %s", ir.IntegerObj, val.Type())
+	}
+
+	if integer.Value < 0 {
+		return integer.Value + int64(length), nil
+	}
+
+	return integer.Value, nil
+}
+
+func isTruthy(obj ir.Object) bool {
+	switch obj := obj.(type) {
+	case *ir.Null:
+		return false
+	case *ir.Boolean:
+		return obj.Value
+	default:
+		return true
+	}
+}
+
+func isError(obj ir.Object) bool {
+	return obj != nil && obj.Type() == ir.ErrorObj
+}
+
+func newError(format string, a ...interface{}) *ir.Error {
+	return &ir.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func nativeBoolToBooleanObject(input bool) *ir.Boolean {
+	if input {
+		return True
+	}
+
+	return False
+}
@@ -0,0 +1,246 @@
+package eval
+
+import (
+	"testing"
+
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+)
+
+type evalTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []evalTestCase{
+		{"5", 5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []evalTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" < "b"`, true},
+		{`"mon" + "key" == "monkey"`, true},
+		{"[1, [2]] == [1, [2]]", true},
+		{"{1: 2} == {1: 3}", false},
+		{"1 == true", false},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []evalTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1) { 10 }", 10},
+		{"if (false) { 10 }", Null},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let x = 1; }", Null},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []evalTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let one = 1;", Null},
+		{"1; let one = 2;", 1},
+		{"export let one = 1; one + one", 2},
+		{`import "lib"; 1`, &ir.Error{Message: `cannot import "lib": the evaluator doesn't support modules`}},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestStrings(t *testing.T) {
+	tests := []evalTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{`"héllo"[1]`, "é"},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[1:if (false) { 1 }]`, "onkey"},
+		{`"monkey"[-3:]`, "key"},
+		{`let x = 41; "value: ${x + 1}, ${[true]}"`, "value: 42, [true]"},
+		{`let x = 1; "$$ $${x} $$${x}"`, "$$ ${x} $1"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestArraysAndHashes(t *testing.T) {
+	tests := []evalTestCase{
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][3]", Null},
+		{"[1][-1]", Null},
+		{"[1, 2, 3, 4][1:-1]", []int{2, 3}},
+		{"[1, 2, 3][[][0]:2]", []int{1, 2}},
+		{"[1, 2, 3][2:1]", Null},
+		{`{"a": 1, 2: 2, true: 3}["a"]`, 1},
+		{`{"a": 1, 2: 2, true: 3}[true]`, 3},
+		{`{"a": 1}["b"]`, Null},
+		{`{"b": 1, "a": 2}`, "{b: 1, a: 2}"},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []evalTestCase{
+		{"let identity = function(x) { x; }; identity(5);", 5},
+		{"let identity = function(x) { return x; 10 }; identity(5);", 5},
+		{"let add = function(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"function(x) { x; }(5)", 5},
+		{"let f = function() { let x = 1; }; f()", Null},
+		{"let f = function() { }; f()", Null},
+		{"if (true) { if (true) { return 10; } return 1; }", 10},
+		{`
+		let newAdder = function(x) { function(y) { x + y } };
+		let addTwo = newAdder(2);
+		addTwo(3);
+		`, 5},
+		{`
+		let fibonacci = function(x) {
+			if (x < 2) { return x; }
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);
+		`, 610},
+		{`
+		let f = function() {
+			let countDown = function(x) { if (x == 0) { return 0; } countDown(x - 1); };
+			countDown(3);
+		};
+		f();
+		`, 0},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []evalTestCase{
+		{"5 + true; 5;", &ir.Error{Message: "unsupported types for binary operation: Integer Boolean"}},
+		{"-true", &ir.Error{Message: "unsupported type for negation: Boolean"}},
+		{"true > false", &ir.Error{Message: "unknown operator: Boolean > Boolean"}},
+		{`"a" - "b"`, &ir.Error{Message: "unknown operator: String - String"}},
+		{"if (10 > 1) { true + false; 10 }", &ir.Error{Message: "unsupported types for binary operation: Boolean Boolean"}},
+		{"foobar", &ir.Error{Message: "undefined variable foobar"}},
+		{"1 / 0", &ir.Error{Message: "division by zero"}},
+		{"{[1]: 2}", &ir.Error{Message: "unusable as hash key: Array"}},
+		{"{}[function() {}]", &ir.Error{Message: "unusable as hash key: Function"}},
+		{"1[0]", &ir.Error{Message: "index operator not supported: Integer"}},
+		{"[1][true:]", &ir.Error{Message: "slice bound must be Integer, got Boolean"}},
+		{"1()", &ir.Error{Message: "not a function: Integer"}},
+		{"function(a) { a }()", &ir.Error{Message: "wrong number of arguments: want=1, got=0"}},
+		{"let f = function() { f() }; f()", &ir.Error{Message: "stack overflow: MaxDepth (65536) exceeded"}},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []evalTestCase{
+		{"assert(true)", Null},
+		{`assert(1, "ones are truthy")`, Null},
+		{`assert_eq([1, "a"], [1, "a"])`, Null},
+		{`assert_error(function() { 1 / 0 }, "division by zero")`, Null},
+		{"let assert = function(x) { x * 2 }; assert(2)", 4},
+		{"assert(false)", &ir.Error{Message: "assertion failed"}},
+		{"assert_eq(1 + 1, 3)", &ir.Error{Message: "assertion failed: got 2, want 3"}},
+		{"assert_error(function() { 1 })", &ir.Error{Message: "assertion failed: want an error, got 1"}},
+		{"assert_error(1)", &ir.Error{Message: "argument to assert_error must be a function, got Integer"}},
+		{`read_file("a.txt")`, &ir.Error{Message: "cannot read a.txt: permission denied"}},
+		{`len("héllo, 世界")`, 9},
+		{`len([1, [2, 3]])`, 2},
+		{`len({"a": 1, "b": 2, "a": 3})`, 2},
+		{`let s = "世界"; s[len(s) - 1]`, "界"},
+		{"len(1)", &ir.Error{Message: "argument to len not supported: Integer"}},
+		{`len("a", "b")`, &ir.Error{Message: "wrong number of arguments: want=1, got=2"}},
+	}
+
+	runEvalTests(t, tests)
+}
+
+func runEvalTests(t *testing.T, tests []evalTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		actual := Eval(program, ir.NewEnvironment())
+
+		testExpectedObject(t, tt.input, tt.expected, actual)
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual ir.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*ir.Integer)
+		if !ok || result.Value != int64(expected) {
+			t.Errorf("%s: want %d, got %T (%+v)", input, expected, actual, actual)
+		}
+	case bool:
+		if actual != nativeBoolToBooleanObject(expected) {
+			t.Errorf("%s: want %t, got %T (%+v)", input, expected, actual, actual)
+		}
+	case string:
+		if actual == nil || actual.Inspect() != expected {
+			t.Errorf("%s: want %q, got %T (%+v)", input, expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*ir.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%s: want %v, got %T (%+v)", input, expected, actual, actual)
+			return
+		}
+
+		for i, element := range expected {
+			testExpectedObject(t, input, element, array.Elements[i])
+		}
+	case *ir.Null:
+		if actual != Null {
+			t.Errorf("%s: want null, got %T (%+v)", input, actual, actual)
+		}
+	case *ir.Error:
+		errObj, ok := actual.(*ir.Error)
+		if !ok {
+			t.Errorf("%s: want error %q, got %T (%+v)", input, expected.Message, actual, actual)
+			return
+		}
+
+		if errObj.Message != expected.Message {
+			t.Errorf("%s: wrong error message. want=%q, got=%q", input, expected.Message, errObj.Message)
+		}
+	}
+}
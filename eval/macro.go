@@ -0,0 +1,235 @@
+package eval
+
+import (
+	"fmt"
+	"strconv"
+
+	"gocompiler/ast"
+	"gocompiler/ir"
+	"gocompiler/token"
+)
+
+// MaxExpansionDepth is how deeply macro expansions may nest, that is, how
+// many times the code a macro returns may again contain macro calls.
+const MaxExpansionDepth = 1 << 8
+
+// DefineMacros removes the top-level let statements that bind macros from
+// program and defines the macros in env. Macros defined elsewhere stay in
+// the program, and compiling or running it fails.
+func DefineMacros(program *ast.Program, env *ir.Environment) {
+	statements := program.Statements[:0]
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		env.Set(let.Name.Value, &ir.Macro{Parameters: macro.Parameters, Body: macro.Body, Env: env})
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces every call of a macro in env with the code the macro
+// returns. A macro gets its arguments unevaluated, as quotes, and must return
+// a quote. Macros are called by name, so a macro name can't be used for
+// anything else.
+//
+// The macro bodies run at expansion time, in the evaluator. Calls are
+// expanded innermost first, and the code a macro returns is expanded again.
+func ExpandMacros(program ast.Node, env *ir.Environment) (ast.Node, error) {
+	x := &expander{env: env}
+
+	expanded := ast.Modify(program, x.expand)
+	if x.err != nil {
+		return nil, x.err
+	}
+
+	return expanded, nil
+}
+
+type expander struct {
+	env   *ir.Environment
+	depth int
+	err   error
+}
+
+func (x *expander) expand(node ast.Node) ast.Node {
+	if x.err != nil {
+		return node
+	}
+
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return node
+	}
+
+	macro, name := x.macro(call)
+	if macro == nil {
+		return node
+	}
+
+	if len(call.Arguments) != len(macro.Parameters) {
+		x.fail(call, name, "wrong number of arguments: want=%d, got=%d",
+			len(macro.Parameters), len(call.Arguments))
+		return node
+	}
+
+	env := ir.NewEnclosedEnvironment(macro.Env)
+	for i, param := range macro.Parameters {
+		env.Set(param.Value, &ir.Quote{Node: call.Arguments[i]})
+	}
+
+	e := &evaluator{}
+	evaluated := e.eval(macro.Body, env)
+	if returnValue, ok := evaluated.(*ir.ReturnValue); ok {
+		evaluated = returnValue.Value
+	}
+
+	if err, ok := evaluated.(*ir.Error); ok {
+		x.fail(call, name, "%s", err.Message)
+		return node
+	}
+
+	quote, ok := evaluated.(*ir.Quote)
+	if !ok {
+		x.fail(call, name, "want a quote as result, got %s", evaluated.Type())
+		return node
+	}
+
+	exp, ok := quote.Node.(ast.Expression)
+	if !ok {
+		x.fail(call, name, "want a quoted expression as result, got %T", quote.Node)
+		return node
+	}
+
+	if x.depth >= MaxExpansionDepth {
+		x.fail(call, name, "expansion nested too deeply: MaxExpansionDepth (%d) exceeded", MaxExpansionDepth)
+		return node
+	}
+
+	x.depth++
+	expanded := ast.Modify(exp, x.expand)
+	x.depth--
+
+	return expanded
+}
+
+// macro returns the macro that call calls and its name, or nil if call
+// doesn't call a macro.
+func (x *expander) macro(call *ast.CallExpression) (*ir.Macro, string) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, ""
+	}
+
+	obj, ok := x.env.Get(ident.Value)
+	if !ok {
+		return nil, ""
+	}
+
+	macro, ok := obj.(*ir.Macro)
+	if !ok {
+		return nil, ""
+	}
+
+	return macro, ident.Value
+}
+
+func (x *expander) fail(call *ast.CallExpression, name string, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+
+	if call.Token.Position.IsValid() {
+		x.err = fmt.Errorf("expanding macro %s at %s: %s", name, call.Token.Position, msg)
+	} else {
+		x.err = fmt.Errorf("expanding macro %s: %s", name, msg)
+	}
+}
+
+// quote returns its argument unevaluated, except for the calls of unquote
+// in it, which are replaced with the code for their values.
+func (e *evaluator) quote(args []ast.Expression, env *ir.Environment) ir.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to quote: want=1, got=%d", len(args))
+	}
+
+	var err *ir.Error
+
+	// The argument is copied so that quoting the same code twice, as a
+	// macro body does on every call, gives independent trees.
+	node := ast.Modify(ast.Copy(args[0]), func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isUnquote(call) {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments to unquote: want=1, got=%d", len(call.Arguments))
+			return node
+		}
+
+		val := e.eval(call.Arguments[0], env)
+		if isError(val) {
+			err = val.(*ir.Error)
+			return node
+		}
+
+		exp, ok := objectToExpression(val)
+		if !ok {
+			err = newError("cannot unquote %s", val.Type())
+			return node
+		}
+
+		return exp
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return &ir.Quote{Node: node}
+}
+
+func isQuote(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "quote"
+}
+
+func isUnquote(call *ast.CallExpression) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote"
+}
+
+// objectToExpression returns the code for obj. Only integers, booleans,
+// strings and quotes have one.
+func objectToExpression(obj ir.Object) (ast.Expression, bool) {
+	switch obj := obj.(type) {
+	case *ir.Integer:
+		literal := strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.Int, Literal: literal}, Value: obj.Value}, true
+	case *ir.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: token.Token{Type: token.True, Literal: "true"}, Value: true}, true
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.False, Literal: "false"}, Value: false}, true
+	case *ir.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.String, Literal: obj.Value}, Value: obj.Value}, true
+	case *ir.Quote:
+		exp, ok := ast.Copy(obj.Node).(ast.Expression)
+		return exp, ok
+	default:
+		return nil, false
+	}
+}
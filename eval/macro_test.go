@@ -0,0 +1,216 @@
+package eval
+
+import (
+	"testing"
+
+	"gocompiler/ast"
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []evalTestCase{
+		{"quote(5)", "quote(5)"},
+		{"quote(5 + 8)", "quote((5 + 8))"},
+		{"quote(foobar)", "quote(foobar)"},
+		{"quote(foobar + barfoo)", "quote((foobar + barfoo))"},
+		{"quote(unquote(4))", "quote(4)"},
+		{"quote(unquote(4 + 4))", "quote(8)"},
+		{"quote(8 + unquote(4 + 4))", "quote((8 + 8))"},
+		{"quote(unquote(4 + 4) + 8)", "quote((8 + 8))"},
+		{"let foobar = 8; quote(foobar)", "quote(foobar)"},
+		{"let foobar = 8; quote(unquote(foobar))", "quote(8)"},
+		{"quote(unquote(true))", "quote(true)"},
+		{"quote(unquote(true == false))", "quote(false)"},
+		{`quote(unquote("a" + "b"))`, "quote(ab)"},
+		{"quote(unquote(quote(4 + 4)))", "quote((4 + 4))"},
+		{"let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))", "quote((8 + (4 + 4)))"},
+		{"quote(1, 2)", &ir.Error{Message: "wrong number of arguments to quote: want=1, got=2"}},
+		{"quote(unquote())", &ir.Error{Message: "wrong number of arguments to unquote: want=1, got=0"}},
+		{"quote(unquote(1 / 0))", &ir.Error{Message: "division by zero"}},
+		{"quote(unquote([1]))", &ir.Error{Message: "cannot unquote Array"}},
+		{"macro(a) { a }", &ir.Error{Message: "unexpanded macro literal"}},
+	}
+
+	runEvalTests(t, tests)
+}
+
+// TestQuoteCopies checks that quoting the same code twice gives independent
+// trees, which macros rely on.
+func TestQuoteCopies(t *testing.T) {
+	program := parse(t, "let f = function(x) { quote(unquote(x) + 1) }; [f(1), f(2)]")
+
+	result := Eval(program, ir.NewEnvironment())
+	if result.Inspect() != "[quote((1 + 1)), quote((2 + 1))]" {
+		t.Errorf("wrong result: %s", result.Inspect())
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let add = function(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := ir.NewEnvironment()
+	program := parse(t, input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("add"); ok {
+		t.Fatalf("add should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment")
+	}
+
+	macro, ok := obj.(*ir.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 || macro.Parameters[0].Value != "x" || macro.Parameters[1].Value != "y" {
+		t.Fatalf("wrong macro parameters: %v", macro.Parameters)
+	}
+
+	if macro.Body.String() != "(x + y)" {
+		t.Fatalf("body is not %q. got=%q", "(x + y)", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infix = macro() { quote(1 + 2) }; infix();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) }; reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			// The arguments are code, so the macro may use them more
+			// than once, or not at all.
+			`let twice = macro(x) { quote([unquote(x), unquote(x)]) }; twice(f());`,
+			`[f(), f()]`,
+		},
+		{
+			// Macros can compute the code they return.
+			`let nine = macro() { let n = 1 + 2; quote(unquote(n) * unquote(n * n)) }; nine();`,
+			`3 * 9`,
+		},
+		{
+			// Code returned by a macro is expanded again, and so are
+			// the arguments, innermost first.
+			`let double = macro(x) { quote(unquote(x) * 2) };
+			let quadruple = macro(x) { quote(double(double(unquote(x)))) };
+			quadruple(double(1));`,
+			`1 * 2 * 2 * 2`,
+		},
+		{
+			`let m = macro(x) { quote(unquote(x)) }; let f = function() { m(1) + m(2) };`,
+			`let f = function() { 1 + 2 };`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := parse(t, tt.expected)
+		program := parse(t, tt.input)
+
+		env := ir.NewEnvironment()
+		DefineMacros(program, env)
+
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("%s: expanding failed: %s", tt.input, err)
+			continue
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("%s: not equal. want=%q, got=%q", tt.input, expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let m = macro(a) { quote(a) };\nm();",
+			"expanding macro m at line 2, column 2: wrong number of arguments: want=1, got=0",
+		},
+		{
+			"let m = macro() { 1 }; m();",
+			"expanding macro m at line 1, column 25: want a quote as result, got Integer",
+		},
+		{
+			"let m = macro(a) { unquote(a) }; m(1);",
+			"expanding macro m at line 1, column 35: undefined variable unquote",
+		},
+		{
+			"let m = macro(a) { quote(unquote(a + 1)) }; m(1);",
+			"expanding macro m at line 1, column 46: unsupported types for binary operation: Quote Integer",
+		},
+		{
+			"let m = macro() { quote(m()) }; m();",
+			"expanding macro m at line 1, column 26: expansion nested too deeply: MaxExpansionDepth (256) exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		env := ir.NewEnvironment()
+		DefineMacros(program, env)
+
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error.\nwant=%q\ngot =%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return program
+}
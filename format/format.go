@@ -0,0 +1,330 @@
+// Package format prints programs as canonical source code.
+//
+// Every statement goes on its own line and ends with a semicolon, blocks are
+// indented with tabs, and expressions get only the parentheses that the
+// parser's precedences require:
+//
+//	let add = function(a, b) {
+//		a + b;
+//	};
+//
+//	if ((1 + 2) * 3 > add(1, 2)) {
+//		"yes";
+//	} else {
+//		"no";
+//	};
+//
+// Source keeps single blank lines between statements. Formatting is
+// idempotent: formatting formatted source gives the same source again. The
+// language has no comments yet, so there are none to keep.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+
+	"gocompiler/ast"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+	"gocompiler/token"
+)
+
+// atom is the precedence of expressions that never need parentheses.
+const atom = parser.Index + 1
+
+// Source formats src. If src doesn't parse, the error lists the parser's
+// errors, one per line.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{lines: strings.Split(string(src), "\n")}
+	pr.node(program)
+
+	return pr.buf.Bytes(), nil
+}
+
+// Node returns the source of node. Programs and statements end with a
+// newline, expressions don't.
+func Node(node ast.Node) string {
+	pr := &printer{}
+	pr.node(node)
+
+	return pr.buf.String()
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+	// lines of the source being formatted, to find blank lines between
+	// statements. It is nil when formatting a tree without source.
+	lines []string
+}
+
+func (p *printer) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		p.statements(node.Statements)
+	case *ast.BlockStatement:
+		p.block(node)
+		p.buf.WriteString("\n")
+	case ast.Statement:
+		p.statement(node)
+		p.buf.WriteString("\n")
+	case ast.Expression:
+		p.expression(node, parser.Lowest)
+	}
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	for i, stmt := range statements {
+		if i > 0 && p.blankLineBefore(stmt) {
+			p.buf.WriteString("\n")
+		}
+
+		p.buf.WriteString(strings.Repeat("\t", p.indent))
+		p.statement(stmt)
+		p.buf.WriteString("\n")
+	}
+}
+
+// blankLineBefore reports whether the source has a blank line right before
+// stmt.
+func (p *printer) blankLineBefore(stmt ast.Statement) bool {
+	line := position(stmt).Line
+	if line < 2 || line > len(p.lines) {
+		return false
+	}
+
+	return strings.TrimSpace(p.lines[line-2]) == ""
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.buf.WriteString("let ")
+		p.buf.WriteString(stmt.Name.Value)
+		p.buf.WriteString(" = ")
+		p.expression(stmt.Value, parser.Lowest)
+		p.buf.WriteString(";")
+	case *ast.ReturnStatement:
+		p.buf.WriteString("return ")
+		p.expression(stmt.ReturnValue, parser.Lowest)
+		p.buf.WriteString(";")
+	case *ast.ImportStatement:
+		p.buf.WriteString(`import "` + stmt.Path + `";`)
+	case *ast.ExportStatement:
+		p.buf.WriteString("export ")
+		p.statement(stmt.Statement)
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.Lowest)
+		p.buf.WriteString(";")
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	p.buf.WriteString("{\n")
+	p.indent++
+	p.statements(block.Statements)
+	p.indent--
+	p.buf.WriteString(strings.Repeat("\t", p.indent))
+	p.buf.WriteString("}")
+}
+
+// expression prints exp, in parentheses if it binds less tightly than
+// precedence.
+func (p *printer) expression(exp ast.Expression, precedence int) {
+	if expressionPrecedence(exp) < precedence {
+		p.buf.WriteString("(")
+		defer p.buf.WriteString(")")
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.buf.WriteString(exp.Value)
+	case *ast.IntegerLiteral:
+		p.buf.WriteString(strconv.FormatInt(exp.Value, 10))
+	case *ast.Boolean:
+		p.buf.WriteString(strconv.FormatBool(exp.Value))
+	case *ast.StringLiteral:
+		p.buf.WriteString(`"` + escapeString(exp.Value, false) + `"`)
+	case *ast.InterpolatedString:
+		p.buf.WriteString(`"`)
+		for i, part := range exp.Parts {
+			if str, ok := part.(*ast.StringLiteral); ok {
+				interpolated := i+1 < len(exp.Parts)
+				p.buf.WriteString(escapeString(str.Value, interpolated))
+				continue
+			}
+
+			p.buf.WriteString("${")
+			p.expression(part, parser.Lowest)
+			p.buf.WriteString("}")
+		}
+		p.buf.WriteString(`"`)
+	case *ast.PrefixExpression:
+		p.buf.WriteString(exp.Operator)
+		p.expression(exp.Right, parser.Prefix)
+	case *ast.InfixExpression:
+		// Operators are left-associative, so an operand on the right with
+		// the same precedence needs parentheses.
+		precedence := expressionPrecedence(exp)
+		p.expression(exp.Left, precedence)
+		p.buf.WriteString(" " + exp.Operator + " ")
+		p.expression(exp.Right, precedence+1)
+	case *ast.IfExpression:
+		p.buf.WriteString("if (")
+		p.expression(exp.Condition, parser.Lowest)
+		p.buf.WriteString(") ")
+		p.block(exp.Consequence)
+
+		if exp.Alternative != nil {
+			p.buf.WriteString(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.function("function", exp.Parameters, exp.Body)
+	case *ast.MacroLiteral:
+		p.function("macro", exp.Parameters, exp.Body)
+	case *ast.CallExpression:
+		// Calls, indexes and slices chain from left to right, so any of
+		// them can be called or indexed without parentheses.
+		p.expression(exp.Function, parser.Call)
+		p.buf.WriteString("(")
+		p.expressions(exp.Arguments)
+		p.buf.WriteString(")")
+	case *ast.ArrayLiteral:
+		p.buf.WriteString("[")
+		p.expressions(exp.Elements)
+		p.buf.WriteString("]")
+	case *ast.HashLiteral:
+		p.buf.WriteString("{")
+		for i, pair := range exp.Pairs {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.expression(pair.Key, parser.Lowest)
+			p.buf.WriteString(": ")
+			p.expression(pair.Value, parser.Lowest)
+		}
+		p.buf.WriteString("}")
+	case *ast.IndexExpression:
+		p.expression(exp.Left, parser.Call)
+		p.buf.WriteString("[")
+		p.expression(exp.Index, parser.Lowest)
+		p.buf.WriteString("]")
+	case *ast.SliceExpression:
+		p.expression(exp.Left, parser.Call)
+		p.buf.WriteString("[")
+		if exp.Low != nil {
+			p.expression(exp.Low, parser.Lowest)
+		}
+		p.buf.WriteString(":")
+		if exp.High != nil {
+			p.expression(exp.High, parser.Lowest)
+		}
+		p.buf.WriteString("]")
+	}
+}
+
+// function prints a function or macro literal.
+func (p *printer) function(keyword string, params []*ast.Identifier, body *ast.BlockStatement) {
+	p.buf.WriteString(keyword + "(")
+	for i, param := range params {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.buf.WriteString(param.Value)
+	}
+	p.buf.WriteString(") ")
+	p.block(body)
+}
+
+func (p *printer) expressions(list []ast.Expression) {
+	for i, exp := range list {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.expression(exp, parser.Lowest)
+	}
+}
+
+// escapeString doubles the runs of $ in the string part s that the lexer
+// would otherwise read as the start of ${: those followed by {, and a
+// trailing one if an interpolation follows s.
+func escapeString(s string, interpolated bool) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(s) && s[end] == '$' {
+			end++
+		}
+
+		run := s[i:end]
+		if end < len(s) && s[end] == '{' || end == len(s) && interpolated {
+			run += run
+		}
+
+		b.WriteString(run)
+		i = end
+	}
+
+	return b.String()
+}
+
+func expressionPrecedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(exp.Operator))
+	case *ast.PrefixExpression:
+		return parser.Prefix
+	case *ast.CallExpression:
+		return parser.Call
+	case *ast.IndexExpression, *ast.SliceExpression:
+		return parser.Index
+	default:
+		return atom
+	}
+}
+
+// position returns where stmt starts in the source.
+func position(stmt ast.Statement) token.Position {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Position
+	case *ast.ReturnStatement:
+		return stmt.Token.Position
+	case *ast.ImportStatement:
+		return stmt.Token.Position
+	case *ast.ExportStatement:
+		return stmt.Token.Position
+	case *ast.ExpressionStatement:
+		return stmt.Token.Position
+	case *ast.BlockStatement:
+		return stmt.Token.Position
+	default:
+		return token.Position{}
+	}
+}
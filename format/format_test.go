@@ -0,0 +1,143 @@
+package format
+
+import (
+	"testing"
+
+	"gocompiler/ast"
+	"gocompiler/difftest"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let x=5", "let x = 5;\n"},
+		{"1+2*3; (1+2)*3; 1-(2-3); (1-2)-3", "1 + 2 * 3;\n(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"-(1+2); -a[0]; (-a)[0]; !(a==b); --1", "-(1 + 2);\n-a[0];\n(-a)[0];\n!(a == b);\n--1;\n"},
+		{"a<b==(c>d); a==(b==c)", "a < b == c > d;\na == (b == c);\n"},
+		{"f(1)(2)[3][1:](4); (a+b)(c); a[:2]; a[1:]", "f(1)(2)[3][1:](4);\n(a + b)(c);\na[:2];\na[1:];\n"},
+		{`[1,[2,3]]; {"a":1,true:[]}; {}; []`, "[1, [2, 3]];\n{\"a\": 1, true: []};\n{};\n[];\n"},
+		{`"a${x+1}b${ {"k": "${y}"}["k"] }"`, "\"a${x + 1}b${{\"k\": \"${y}\"}[\"k\"]}\";\n"},
+		{`"$${x} $ $$$${"`, "\"$${x} $ $$$${\";\n"},
+		{`"a$$${x}$$$${"`, "\"a$$${x}$$$${\";\n"},
+		{`"$$ a$$b $"`, "\"$$ a$$b $\";\n"},
+		{
+			"let add=function(a,b){a+b};add(1,2)",
+			"let add = function(a, b) {\n\ta + b;\n};\nadd(1, 2);\n",
+		},
+		{
+			"if(x>1){if(y){return 1;}}else{2}",
+			"if (x > 1) {\n\tif (y) {\n\t\treturn 1;\n\t};\n} else {\n\t2;\n};\n",
+		},
+		{
+			"let f = function() { };\nf()",
+			"let f = function() {};\nf();\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = function() {\n  let d = 1;\n\n  d\n};",
+			"let a = 1;\n\nlet b = 2;\nlet c = function() {\n\tlet d = 1;\n\n\td;\n};\n",
+		},
+		{"function(x){x}(5)", "function(x) {\n\tx;\n}(5);\n"},
+		{
+			"import \"lib\"\nimport \"util.mk\";\n\nexport let x=1",
+			"import \"lib\";\nimport \"util.mk\";\n\nexport let x = 1;\n",
+		},
+		{"let m=macro(a,b){quote(unquote(b)-unquote(a))}", "let m = macro(a, b) {\n\tquote(unquote(b) - unquote(a));\n};\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+
+		if string(formatted) != tt.expected {
+			t.Errorf("%q: wrong output.\nwant:\n%s\ngot:\n%s", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		again, err := Source(formatted)
+		if err != nil {
+			t.Errorf("%q: formatted source doesn't parse: %s", tt.input, err)
+			continue
+		}
+
+		if string(again) != string(formatted) {
+			t.Errorf("%q: formatting isn't idempotent.\nfirst:\n%s\nsecond:\n%s", tt.input, formatted, again)
+		}
+
+		if parse(t, string(formatted)).String() != parse(t, tt.input).String() {
+			t.Errorf("%q: formatting changed the program", tt.input)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let = 1;\nlet y = ∑;"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	expected := "expected next token to be Identifier, got = instead\n" +
+		"no prefix parse function for = found\n" +
+		`illegal character "∑" at line 2, column 9`
+	if err.Error() != expected {
+		t.Errorf("wrong error.\nwant:\n%s\ngot:\n%s", expected, err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	program := parse(t, "let x = -(1 + 2);")
+	let := program.Statements[0].(*ast.LetStatement)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "let x = -(1 + 2);\n"},
+		{let, "let x = -(1 + 2);\n"},
+		{let.Value, "-(1 + 2)"},
+	}
+
+	for _, tt := range tests {
+		if got := Node(tt.node); got != tt.expected {
+			t.Errorf("wrong output for %T. want=%q, got=%q", tt.node, tt.expected, got)
+		}
+	}
+}
+
+// TestGeneratedPrograms formats random programs and checks that parsing the
+// output gives the same tree.
+func TestGeneratedPrograms(t *testing.T) {
+	seeds := 500
+	if testing.Short() {
+		seeds = 50
+	}
+
+	for seed := 0; seed < seeds; seed++ {
+		program := difftest.NewGenerator(int64(seed)).Program()
+		formatted := Node(program)
+
+		if got := parse(t, formatted).String(); got != program.String() {
+			t.Fatalf("seed %d: formatting changed the program.\nformatted:\n%s\nwant:\n%s\ngot:\n%s",
+				seed, formatted, program.String(), got)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return program
+}
@@ -0,0 +1,169 @@
+package ir
+
+import (
+	"fmt"
+	"io/fs"
+	"unicode/utf8"
+)
+
+// Builtins lists the builtin functions. The compiler refers to them by
+// their index in this list, so new builtins are added at the end.
+var Builtins = []*Builtin{
+	{Name: "assert", Fn: assert},
+	{Name: "assert_eq", Fn: assertEq},
+	{Name: "assert_error", Fn: assertError},
+	{Name: "read_file", Fn: readFile},
+	{Name: "len", Fn: length},
+}
+
+// LookupBuiltin returns the builtin called name, or nil if there is none.
+func LookupBuiltin(name string) *Builtin {
+	for _, builtin := range Builtins {
+		if builtin.Name == name {
+			return builtin
+		}
+	}
+
+	return nil
+}
+
+// assert(condition) fails unless condition is truthy. An optional second
+// argument is a message to fail with.
+func assert(caller Caller, args ...Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments: want=1 or 2, got=%d", len(args))
+	}
+
+	message, err := assertMessage(args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch condition := args[0].(type) {
+	case *Null:
+	case *Boolean:
+		if condition.Value {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	if message != "" {
+		return nil, fmt.Errorf("assertion failed: %s", message)
+	}
+
+	return nil, fmt.Errorf("assertion failed")
+}
+
+// assert_eq(got, want) fails unless got equals want.
+func assertEq(caller Caller, args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments: want=2, got=%d", len(args))
+	}
+
+	if !Equal(args[0], args[1]) {
+		return nil, fmt.Errorf("assertion failed: got %s, want %s", args[0].Inspect(), args[1].Inspect())
+	}
+
+	return nil, nil
+}
+
+// assert_error(function) calls function without arguments and fails unless
+// it raises an error. An optional second argument is the error message the
+// function has to raise.
+func assertError(caller Caller, args ...Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments: want=1 or 2, got=%d", len(args))
+	}
+
+	want, err := assertMessage(args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch args[0].(type) {
+	case *Closure, *Function, *Builtin:
+	default:
+		return nil, fmt.Errorf("argument to assert_error must be a function, got %s", args[0].Type())
+	}
+
+	result, err := caller.Call(args[0])
+	if err == nil {
+		return nil, fmt.Errorf("assertion failed: want an error, got %s", result.Inspect())
+	}
+
+	if want != "" && err.Error() != want {
+		return nil, fmt.Errorf("assertion failed: want error %q, got %q", want, err.Error())
+	}
+
+	return nil, nil
+}
+
+// assertMessage returns the optional string argument at index i.
+func assertMessage(args []Object, i int) (string, error) {
+	if len(args) <= i {
+		return "", nil
+	}
+
+	message, ok := args[i].(*String)
+	if !ok {
+		return "", fmt.Errorf("message must be %s, got %s", StringObj, args[i].Type())
+	}
+
+	return message.Value, nil
+}
+
+// len(value) returns the number of runes of a string, of elements of an
+// array or of pairs of a hash.
+func length(caller Caller, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}, nil
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}, nil
+	case *Hash:
+		return &Integer{Value: int64(arg.Len())}, nil
+	default:
+		return nil, fmt.Errorf("argument to len not supported: %s", arg.Type())
+	}
+}
+
+// read_file(name) returns the contents of the file name, a slash-separated
+// path in the files of the caller. Without files, reading is denied.
+func readFile(caller Caller, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	name, ok := args[0].(*String)
+	if !ok {
+		return nil, fmt.Errorf("argument to read_file must be %s, got %s", StringObj, args[0].Type())
+	}
+
+	files := caller.FS()
+	if files == nil {
+		return nil, fmt.Errorf("cannot read %s: %s", name.Value, fs.ErrPermission)
+	}
+
+	data, err := fs.ReadFile(files, name.Value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %s", name.Value, unwrapPathError(err))
+	}
+
+	return &String{Value: string(data)}, nil
+}
+
+// unwrapPathError drops the operation and path from err, which the message
+// of read_file already names.
+func unwrapPathError(err error) error {
+	if pathErr, ok := err.(*fs.PathError); ok {
+		return pathErr.Err
+	}
+
+	return err
+}
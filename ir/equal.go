@@ -0,0 +1,76 @@
+package ir
+
+// Equal reports whether a and b hold the same value. Integers, booleans
+// and strings compare by value, arrays and hashes element by element, and
+// everything else, such as functions, by identity. Values of different
+// types are never equal.
+func Equal(a, b Object) bool {
+	return equal(a, b, make(map[visit]bool))
+}
+
+// visit records a pair of containers being compared, so that a container
+// that refers to itself doesn't make the comparison recurse forever.
+type visit struct {
+	a, b Object
+}
+
+func equal(a, b Object, visited map[visit]bool) bool {
+	if a == b {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+
+		// A pair already being compared is assumed equal; any difference
+		// is found where the comparison started.
+		v := visit{a, b}
+		if visited[v] {
+			return true
+		}
+		visited[v] = true
+
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], visited) {
+				return false
+			}
+		}
+
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+
+		v := visit{a, b}
+		if visited[v] {
+			return true
+		}
+		visited[v] = true
+
+		for _, pair := range a.Pairs() {
+			value, ok := b.Get(pair.Key.(Hashable))
+			if !ok || !equal(pair.Value, value, visited) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return false
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"io/fs"
 	"strings"
+	"sync/atomic"
 
 	"gocompiler/ast"
 	"gocompiler/opcode"
@@ -25,6 +27,9 @@ const (
 	HashObj             = "Hash"
 	CompiledFunctionObj = "CompiledFunction"
 	ClosureObj          = "Closure"
+	BuiltinObj          = "Builtin"
+	QuoteObj            = "Quote"
+	MacroObj            = "Macro"
 )
 
 type HashKey struct {
@@ -33,6 +38,7 @@ type HashKey struct {
 }
 
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
@@ -113,17 +119,66 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// Quote is an unevaluated expression, the result of quote(expression).
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QuoteObj }
+func (q *Quote) Inspect() string  { return "quote(" + q.Node.String() + ")" }
+
+// Macro is a macro bound by a top-level let statement. Calling it at
+// expansion time gives the code that replaces the call.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MacroObj }
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	var params []string
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
 type String struct {
+	// hash caches the FNV hash of Value once hashed is set. It comes first
+	// to be 64-bit aligned for atomic access on 32-bit platforms: constant
+	// strings may be shared by VMs running in parallel.
+	hash   uint64
+	hashed uint32
+
 	Value string
 }
 
 func (s *String) Type() ObjectType { return StringObj }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) HashKey() HashKey {
+	if atomic.LoadUint32(&s.hashed) == 1 {
+		return HashKey{Type: s.Type(), Value: atomic.LoadUint64(&s.hash)}
+	}
+
 	h := fnv.New64a()
 	_, _ = h.Write([]byte(s.Value))
+	hash := h.Sum64()
+
+	atomic.StoreUint64(&s.hash, hash)
+	atomic.StoreUint32(&s.hashed, 1)
 
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return HashKey{Type: s.Type(), Value: hash}
 }
 
 type Array struct {
@@ -151,16 +206,66 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash keeps its pairs in insertion order. Keys whose hash keys collide
+// share a bucket and are told apart by comparing the keys themselves.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	buckets map[HashKey][]int // indices into pairs
+	pairs   []HashPair
 }
 
+func NewHash() *Hash {
+	return &Hash{buckets: make(map[HashKey][]int)}
+}
+
+// Set stores value under key. A key that is already present keeps its
+// position in the insertion order.
+func (h *Hash) Set(key Hashable, value Object) {
+	if h.buckets == nil {
+		h.buckets = make(map[HashKey][]int)
+	}
+
+	hashKey := key.HashKey()
+
+	if i, ok := h.find(hashKey, key); ok {
+		h.pairs[i].Value = value
+		return
+	}
+
+	h.buckets[hashKey] = append(h.buckets[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	i, ok := h.find(key.HashKey(), key)
+	if !ok {
+		return nil, false
+	}
+
+	return h.pairs[i].Value, true
+}
+
+func (h *Hash) find(hashKey HashKey, key Hashable) (int, bool) {
+	for _, i := range h.buckets[hashKey] {
+		if Equal(h.pairs[i].Key, key) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// Pairs returns the pairs of h in insertion order. The slice must not be
+// modified.
+func (h *Hash) Pairs() []HashPair { return h.pairs }
+
 func (h *Hash) Type() ObjectType { return HashObj }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	var pairs []string
-	for _, pair := range h.Pairs {
+	for _, pair := range h.pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -175,6 +280,12 @@ type CompiledFunction struct {
 	Instructions  opcode.Instructions
 	NumLocals     int
 	NumParameters int
+	// Positions maps the offsets of instructions that can fail at runtime to
+	// where they come from in the source. It is empty for optimised code.
+	Positions map[int]token.Position
+	// File is the module the function was compiled from, or empty for the
+	// main program.
+	File string
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return CompiledFunctionObj }
@@ -192,3 +303,25 @@ func (c *Closure) Type() ObjectType { return ClosureObj }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Caller gives builtins access to what runs them. It calls functions on
+// behalf of builtins that take functions as arguments, such as assert_error,
+// and provides the files that builtins such as read_file may read.
+type Caller interface {
+	Call(fn Object, args ...Object) (Object, error)
+	// FS returns the files the program may read, or nil if it may read
+	// none.
+	FS() fs.FS
+}
+
+// BuiltinFunction implements a builtin. It returns nil for null, and an
+// error to stop the program.
+type BuiltinFunction func(caller Caller, args ...Object) (Object, error)
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BuiltinObj }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
@@ -10,3 +10,104 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with same content have different hash keys")
 	}
 }
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+
+	for _, pair := range []HashPair{
+		{Key: &String{Value: "b"}, Value: &Integer{Value: 1}},
+		{Key: &Integer{Value: 1}, Value: &Integer{Value: 2}},
+		{Key: &String{Value: "a"}, Value: &Integer{Value: 3}},
+		{Key: &String{Value: "b"}, Value: &Integer{Value: 4}},
+	} {
+		hash.Set(pair.Key.(Hashable), pair.Value)
+	}
+
+	expected := "{b: 4, 1: 2, a: 3}"
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. want=%q, got=%q", expected, hash.Inspect())
+	}
+}
+
+func TestHashCollisions(t *testing.T) {
+	one := &String{Value: "one"}
+	two := &String{Value: "two"}
+
+	// Force both strings into the same bucket.
+	collision := one.HashKey().Value
+	two.hash, two.hashed = collision, 1
+
+	if one.HashKey() != two.HashKey() {
+		t.Fatalf("hash keys don't collide")
+	}
+
+	hash := NewHash()
+	hash.Set(one, &Integer{Value: 1})
+	hash.Set(two, &Integer{Value: 2})
+	hash.Set(&Integer{Value: 1}, &Integer{Value: 3})
+
+	if hash.Len() != 3 {
+		t.Fatalf("hash has wrong length. want=3, got=%d", hash.Len())
+	}
+
+	tests := []struct {
+		key      Hashable
+		expected int64
+	}{
+		{&String{Value: "one"}, 1},
+		{two, 2},
+		{&Integer{Value: 1}, 3},
+	}
+
+	for _, tt := range tests {
+		value, ok := hash.Get(tt.key)
+		if !ok {
+			t.Errorf("no value for key %s", tt.key.Inspect())
+			continue
+		}
+
+		if value.(*Integer).Value != tt.expected {
+			t.Errorf("wrong value for key %s. want=%d, got=%s", tt.key.Inspect(), tt.expected, value.Inspect())
+		}
+	}
+
+	if _, ok := hash.Get(&String{Value: "three"}); ok {
+		t.Errorf("found value for missing key")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	cyclic := func() *Array {
+		array := &Array{Elements: []Object{&Integer{Value: 1}, nil}}
+		array.Elements[1] = array
+		return array
+	}
+
+	hash := func(key, value Object) *Hash {
+		hash := NewHash()
+		hash.Set(key.(Hashable), value)
+		return hash
+	}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&Integer{Value: 1}, &Boolean{Value: true}, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{&String{Value: "a"}, &String{Value: "b"}, false},
+		{&Array{Elements: []Object{&String{Value: "a"}}}, &Array{Elements: []Object{&String{Value: "a"}}}, true},
+		{&Array{}, &Array{Elements: []Object{&Integer{Value: 1}}}, false},
+		{hash(&String{Value: "a"}, &Integer{Value: 1}), hash(&String{Value: "a"}, &Integer{Value: 1}), true},
+		{hash(&String{Value: "a"}, &Integer{Value: 1}), hash(&String{Value: "b"}, &Integer{Value: 1}), false},
+		{cyclic(), cyclic(), true},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d]: Equal(%s, %s) wrong. want=%t, got=%t",
+				i, tt.a.Type(), tt.b.Type(), tt.expected, got)
+		}
+	}
+}
@@ -1,18 +1,31 @@
 package lexer
 
 import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"gocompiler/token"
 )
 
+// Lexer reads its input as UTF-8, one rune at a time. Bytes that are not
+// valid UTF-8 are read as utf8.RuneError and become Illegal tokens.
 type Lexer struct {
 	input        string
 	position     int
 	nextPosition int
-	ch           byte
+	ch           rune
+
+	line   int
+	column int
+
+	// interpolations holds, for each interpolated string being read, how
+	// many braces are open inside its current ${...}.
+	interpolations []int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -22,6 +35,8 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhitespace()
 
+	pos := token.Position{Line: l.line, Column: l.column}
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -64,8 +79,25 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RightParen, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LeftBrace, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			// The brace closes ${...}: carry on with the string.
+			l.interpolations = l.interpolations[:n-1]
+			tok.Type = token.StringEnd
+			tok.Literal = l.readString()
+			if l.ch == '{' {
+				tok.Type = token.StringMiddle
+			}
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1]--
+		}
 		tok = newToken(token.RightBrace, l.ch)
 	case '[':
 		tok = newToken(token.LeftBracket, l.ch)
@@ -74,6 +106,9 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		tok.Type = token.String
 		tok.Literal = l.readString()
+		if l.ch == '{' {
+			tok.Type = token.StringStart
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -81,10 +116,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifierType(tok.Literal)
+			tok.Position = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.Int
+			tok.Position = pos
 			return tok
 		} else {
 			tok = newToken(token.Illegal, l.ch)
@@ -92,28 +129,85 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Position = pos
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 func (l *Lexer) readChar() {
-	l.ch = l.peekChar()
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	// EOF sits one column past the last rune.
+	if l.position < len(l.input) || l.column == 0 {
+		l.column++
+	}
+
 	l.position = l.nextPosition
-	l.nextPosition += 1
+	if l.position >= len(l.input) {
+		l.ch = 0
+		return
+	}
+
+	ch, size := utf8.DecodeRuneInString(l.input[l.position:])
+	l.ch = ch
+	l.nextPosition += size
 }
 
+// readString reads up to the closing quote or to the next ${, whichever
+// comes first. In the second case it stops on the brace and starts a new
+// interpolation. In a run of $ before a {, $$ stands for a single $, so $${
+// is a literal ${ and $$${x} is a $ followed by x. Elsewhere, $ is an
+// ordinary character.
 func (l *Lexer) readString() string {
+	var str strings.Builder
+
 	pos := l.position + 1
 	for {
 		l.readChar()
+		if l.ch == '$' {
+			end := l.position
+			for end < len(l.input) && l.input[end] == '$' {
+				end++
+			}
+
+			if end == len(l.input) || l.input[end] != '{' {
+				// Skip the run, which is read as it is.
+				for l.position < end-1 {
+					l.readChar()
+				}
+				continue
+			}
+
+			run := end - l.position
+			str.WriteString(l.input[pos:l.position])
+			str.WriteString(strings.Repeat("$", run/2))
+
+			for l.position < end {
+				l.readChar()
+			}
+
+			if run%2 == 1 {
+				l.interpolations = append(l.interpolations, 0)
+				return str.String()
+			}
+
+			// The brace is part of the string.
+			pos = l.position
+			continue
+		}
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
 	}
-	return l.input[pos:l.position]
+
+	str.WriteString(l.input[pos:l.position])
+	return str.String()
 }
 
 func (l *Lexer) readNumber() string {
@@ -132,11 +226,12 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[pos:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
@@ -146,10 +241,11 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.nextPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.nextPosition]
 	}
+
+	ch, _ := utf8.DecodeRuneInString(l.input[l.nextPosition:])
+	return ch
 }
@@ -30,6 +30,9 @@ func TestNextToken(t *testing.T) {
 		"foo bar"
 		[1, 2];
 		{"foo": "bar"}
+		macro(x) { x };
+		import "lib";
+		export let
 	`
 
 	tests := []struct {
@@ -122,6 +125,102 @@ func TestNextToken(t *testing.T) {
 		{token.Colon, ":"},
 		{token.String, "bar"},
 		{token.RightBrace, "}"},
+		{token.Macro, "macro"},
+		{token.LeftParen, "("},
+		{token.Identifier, "x"},
+		{token.RightParen, ")"},
+		{token.LeftBrace, "{"},
+		{token.Identifier, "x"},
+		{token.RightBrace, "}"},
+		{token.Semicolon, ";"},
+		{token.Import, "import"},
+		{token.String, "lib"},
+		{token.Semicolon, ";"},
+		{token.Export, "export"},
+		{token.Let, "let"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let имя = \"héllo, 世界\";\nπ + _x2 ∑ \xff"
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedPosition token.Position
+	}{
+		{token.Let, "let", token.Position{Line: 1, Column: 1}},
+		{token.Identifier, "имя", token.Position{Line: 1, Column: 5}},
+		{token.Assign, "=", token.Position{Line: 1, Column: 9}},
+		{token.String, "héllo, 世界", token.Position{Line: 1, Column: 11}},
+		{token.Semicolon, ";", token.Position{Line: 1, Column: 22}},
+		{token.Identifier, "π", token.Position{Line: 2, Column: 1}},
+		{token.Plus, "+", token.Position{Line: 2, Column: 3}},
+		{token.Identifier, "_x", token.Position{Line: 2, Column: 5}},
+		{token.Int, "2", token.Position{Line: 2, Column: 7}},
+		{token.Illegal, "∑", token.Position{Line: 2, Column: 9}},
+		{token.Illegal, "�", token.Position{Line: 2, Column: 11}},
+		{token.EOF, "", token.Position{Line: 2, Column: 12}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Position != tt.expectedPosition {
+			t.Fatalf("tests[%d] - position wrong. expected=%s, got=%s", i, tt.expectedPosition, tok.Position)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"a${x + 1}b${ {"k": "${y}"}["k"] }" "${z}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.StringStart, "a"},
+		{token.Identifier, "x"},
+		{token.Plus, "+"},
+		{token.Int, "1"},
+		{token.StringMiddle, "b"},
+		{token.LeftBrace, "{"},
+		{token.String, "k"},
+		{token.Colon, ":"},
+		{token.StringStart, ""},
+		{token.Identifier, "y"},
+		{token.StringEnd, ""},
+		{token.RightBrace, "}"},
+		{token.LeftBracket, "["},
+		{token.String, "k"},
+		{token.RightBracket, "]"},
+		{token.StringEnd, ""},
+		{token.StringStart, ""},
+		{token.Identifier, "z"},
+		{token.StringEnd, ""},
 		{token.EOF, ""},
 	}
 
@@ -138,3 +237,69 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{`"$${x}"`, []token.Token{{Type: token.String, Literal: "${x}"}}},
+		{`"$$"`, []token.Token{{Type: token.String, Literal: "$$"}}},
+		{`"a$$b$c$"`, []token.Token{{Type: token.String, Literal: "a$$b$c$"}}},
+		{`"$$$${"`, []token.Token{{Type: token.String, Literal: "$${"}}},
+		{`"$$${x}$$"`, []token.Token{
+			{Type: token.StringStart, Literal: "$"},
+			{Type: token.Identifier, Literal: "x"},
+			{Type: token.StringEnd, Literal: "$$"},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%s: token %d wrong. expected=%s %q, got=%s %q",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%s: expected EOF, got=%s %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func FuzzNextToken(f *testing.F) {
+	seeds := []string{
+		"let five = 5;\nlet add = function(x, y) { x + y; };\n!-/*5;\n5 < 10 > 5;",
+		"if (5 < 10) { return true; } else { return false; }\n10 == 10; 10 != 9;",
+		`"foobar" "foo bar" [1, 2]; {"foo": "bar"}`,
+		"let имя = \"héllo, 世界\";\nπ + _x2 ∑ \xff",
+		`"a${x + 1}b${ {"k": "${y}"}["k"] }" "${z}"`,
+		`"unterminated ${`,
+		`"$${x} $$$${" "$$$"`,
+		"}}}",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+
+		// Every token but EOF consumes at least one byte, so a lexer that
+		// returns more tokens than that is stuck.
+		for i := 0; ; i++ {
+			if i > len(input) {
+				t.Fatalf("no EOF after %d tokens", i)
+			}
+
+			tok := l.NextToken()
+			if tok.Type == token.EOF {
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,305 @@
+// Package mkc reads and writes compiled programs in the .mkc file format.
+//
+// A file starts with the magic bytes and the format version, followed by the
+// length of the payload, the payload itself and a CRC-32 checksum over
+// everything before it. The payload holds the debug info, the main program
+// instructions with their source positions and the constant pool. Every
+// constant is prefixed with a tag naming its type.
+package mkc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"gocompiler/compiler"
+	"gocompiler/ir"
+	"gocompiler/opcode"
+	"gocompiler/token"
+)
+
+const Magic = "MKC\x00"
+
+// Version is bumped whenever the layout of the payload or the numbering of
+// the opcodes changes. Files of other versions are rejected.
+const Version = 3
+
+const headerSize = len(Magic) + 2 + 4
+
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagCompiledFunction
+)
+
+// DebugInfo is stored next to the bytecode. It isn't needed to run it.
+type DebugInfo struct {
+	Source string
+}
+
+type File struct {
+	Bytecode *compiler.Bytecode
+	Debug    DebugInfo
+}
+
+func Encode(w io.Writer, file *File) error {
+	var payload bytes.Buffer
+
+	writeString(&payload, file.Debug.Source)
+	writeBytes(&payload, file.Bytecode.Instructions)
+	writePositions(&payload, file.Bytecode.Positions)
+
+	writeUvarint(&payload, uint64(len(file.Bytecode.Constants)))
+	for _, c := range file.Bytecode.Constants {
+		err := writeConstant(&payload, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString(Magic)
+	_ = binary.Write(&out, binary.BigEndian, uint16(Version))
+	_ = binary.Write(&out, binary.BigEndian, uint32(payload.Len()))
+	out.Write(payload.Bytes())
+	_ = binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(out.Bytes()))
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func Decode(r io.Reader) (*File, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, headerSize)
+	_, err := io.ReadFull(br, header)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %s", err)
+	}
+
+	if string(header[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("not an mkc file: bad magic bytes")
+	}
+
+	version := binary.BigEndian.Uint16(header[len(Magic):])
+	if version != Version {
+		return nil, fmt.Errorf("unsupported mkc version %d, want %d", version, Version)
+	}
+
+	size := binary.BigEndian.Uint32(header[len(Magic)+2:])
+
+	body, err := ioutil.ReadAll(io.LimitReader(br, int64(size)+4))
+	if err != nil {
+		return nil, fmt.Errorf("reading payload: %s", err)
+	}
+
+	if len(body) != int(size)+4 {
+		return nil, fmt.Errorf("reading payload: %s", io.ErrUnexpectedEOF)
+	}
+
+	payload := body[:size]
+	checksum := binary.BigEndian.Uint32(body[size:])
+
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write(header)
+	_, _ = crc.Write(payload)
+	if crc.Sum32() != checksum {
+		return nil, fmt.Errorf("checksum mismatch: file is corrupted")
+	}
+
+	d := &decoder{buf: bytes.NewReader(payload)}
+
+	file := &File{Bytecode: &compiler.Bytecode{}}
+	file.Debug.Source = d.readString()
+	file.Bytecode.Instructions = opcode.Instructions(d.readBytes())
+	file.Bytecode.Positions = d.readPositions()
+
+	count := d.readUvarint()
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		file.Bytecode.Constants = append(file.Bytecode.Constants, d.readConstant())
+	}
+
+	if d.err == nil && d.buf.Len() != 0 {
+		d.err = fmt.Errorf("%d trailing bytes", d.buf.Len())
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("malformed payload: %s", d.err)
+	}
+
+	return file, nil
+}
+
+func writeConstant(buf *bytes.Buffer, obj ir.Object) error {
+	switch obj := obj.(type) {
+	case *ir.Integer:
+		buf.WriteByte(tagInteger)
+		writeVarint(buf, obj.Value)
+	case *ir.String:
+		buf.WriteByte(tagString)
+		writeString(buf, obj.Value)
+	case *ir.CompiledFunction:
+		buf.WriteByte(tagCompiledFunction)
+		writeBytes(buf, obj.Instructions)
+		writeUvarint(buf, uint64(obj.NumLocals))
+		writeUvarint(buf, uint64(obj.NumParameters))
+		writePositions(buf, obj.Positions)
+		writeString(buf, obj.File)
+	default:
+		return fmt.Errorf("can't encode constant of type %s", obj.Type())
+	}
+
+	return nil
+}
+
+// writePositions writes the number of positions followed by each offset with
+// its line and column, in the order of the offsets.
+func writePositions(buf *bytes.Buffer, positions map[int]token.Position) {
+	offsets := make([]int, 0, len(positions))
+	for offset := range positions {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+
+	writeUvarint(buf, uint64(len(offsets)))
+	for _, offset := range offsets {
+		writeUvarint(buf, uint64(offset))
+		writeUvarint(buf, uint64(positions[offset].Line))
+		writeUvarint(buf, uint64(positions[offset].Column))
+	}
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	buf.Write(b[:binary.PutUvarint(b, v)])
+}
+
+func writeVarint(buf *bytes.Buffer, v int64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	buf.Write(b[:binary.PutVarint(b, v)])
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeBytes(buf, []byte(s))
+}
+
+// decoder reads the payload and remembers the first error, so the caller
+// only has to check it once.
+type decoder struct {
+	buf *bytes.Reader
+	err error
+}
+
+func (d *decoder) readConstant() ir.Object {
+	tag := d.readByte()
+	if d.err != nil {
+		return nil
+	}
+
+	switch tag {
+	case tagInteger:
+		return &ir.Integer{Value: d.readVarint()}
+	case tagString:
+		return &ir.String{Value: d.readString()}
+	case tagCompiledFunction:
+		return &ir.CompiledFunction{
+			Instructions:  opcode.Instructions(d.readBytes()),
+			NumLocals:     int(d.readUvarint()),
+			NumParameters: int(d.readUvarint()),
+			Positions:     d.readPositions(),
+			File:          d.readString(),
+		}
+	default:
+		d.err = fmt.Errorf("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+func (d *decoder) readPositions() map[int]token.Position {
+	count := d.readUvarint()
+	if d.err != nil || count == 0 {
+		return nil
+	}
+
+	positions := make(map[int]token.Position)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		offset := int(d.readUvarint())
+		positions[offset] = token.Position{
+			Line:   int(d.readUvarint()),
+			Column: int(d.readUvarint()),
+		}
+	}
+
+	return positions
+}
+
+func (d *decoder) readByte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	b, err := d.buf.ReadByte()
+	if err != nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+
+	return b
+}
+
+func (d *decoder) readUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadUvarint(d.buf)
+	if err != nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+
+	return v
+}
+
+func (d *decoder) readVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadVarint(d.buf)
+	if err != nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+
+	return v
+}
+
+func (d *decoder) readBytes() []byte {
+	n := d.readUvarint()
+	if d.err != nil {
+		return nil
+	}
+
+	if n > uint64(d.buf.Len()) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	b := make([]byte, n)
+	_, _ = io.ReadFull(d.buf, b)
+
+	return b
+}
+
+func (d *decoder) readString() string {
+	return string(d.readBytes())
+}
@@ -0,0 +1,230 @@
+package mkc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"gocompiler/compiler"
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+	"gocompiler/token"
+	"gocompiler/vm"
+)
+
+const program = `
+let newAdder = function(a, b) {
+	let c = a + b;
+	function(d) { c + d };
+};
+let adder = newAdder(1, 2);
+let name = "monkey";
+if (adder(8) > 10) { [name, adder(-100)] } else { "no" }
+`
+
+func TestRoundTrip(t *testing.T) {
+	bytecode := compile(t, program)
+	if len(bytecode.Positions) == 0 {
+		t.Fatalf("program has no positions to encode")
+	}
+
+	var buf bytes.Buffer
+	err := Encode(&buf, &File{Bytecode: bytecode, Debug: DebugInfo{Source: "adder.mk"}})
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	file, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if file.Debug.Source != "adder.mk" {
+		t.Errorf("wrong source. want=%q, got=%q", "adder.mk", file.Debug.Source)
+	}
+
+	if !bytes.Equal(file.Bytecode.Instructions, bytecode.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q", bytecode.Instructions, file.Bytecode.Instructions)
+	}
+
+	if !equalPositions(file.Bytecode.Positions, bytecode.Positions) {
+		t.Errorf("wrong positions.\nwant=%v\ngot=%v", bytecode.Positions, file.Bytecode.Positions)
+	}
+
+	if len(file.Bytecode.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(bytecode.Constants), len(file.Bytecode.Constants))
+	}
+
+	for i, want := range bytecode.Constants {
+		got := file.Bytecode.Constants[i]
+
+		if got.Type() != want.Type() {
+			t.Errorf("constant %d has wrong type. want=%s, got=%s", i, want.Type(), got.Type())
+			continue
+		}
+
+		if fn, ok := want.(*ir.CompiledFunction); ok {
+			gotFn := got.(*ir.CompiledFunction)
+			if !bytes.Equal(gotFn.Instructions, fn.Instructions) ||
+				gotFn.NumLocals != fn.NumLocals || gotFn.NumParameters != fn.NumParameters ||
+				!equalPositions(gotFn.Positions, fn.Positions) || gotFn.File != fn.File {
+				t.Errorf("constant %d differs. want=%+v, got=%+v", i, fn, gotFn)
+			}
+		} else if got.Inspect() != want.Inspect() {
+			t.Errorf("constant %d differs. want=%s, got=%s", i, want.Inspect(), got.Inspect())
+		}
+	}
+
+	machine := vm.New(file.Bytecode)
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	result := machine.LastPoppedStackElem().Inspect()
+	if result != "[monkey, -97]" {
+		t.Errorf("wrong result. want=%q, got=%q", "[monkey, -97]", result)
+	}
+}
+
+func TestRoundTripFunctionFile(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Constants: []ir.Object{&ir.CompiledFunction{File: "lib/greet.mk"}},
+	}
+
+	var buf bytes.Buffer
+	err := Encode(&buf, &File{Bytecode: bytecode})
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	file, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	fn := file.Bytecode.Constants[0].(*ir.CompiledFunction)
+	if fn.File != "lib/greet.mk" {
+		t.Errorf("wrong file. want=%q, got=%q", "lib/greet.mk", fn.File)
+	}
+}
+
+// TestDecodeRejectsVersion2 checks that files written before the files of
+// functions were stored are rejected instead of being misread.
+func TestDecodeRejectsVersion2(t *testing.T) {
+	var payload bytes.Buffer
+	writeString(&payload, "")
+	writeBytes(&payload, nil)
+	writePositions(&payload, nil)
+	writeUvarint(&payload, 1)
+	payload.WriteByte(tagCompiledFunction)
+	writeBytes(&payload, nil)
+	writeUvarint(&payload, 0)
+	writeUvarint(&payload, 0)
+	writePositions(&payload, nil)
+
+	var file bytes.Buffer
+	file.WriteString(Magic)
+	_ = binary.Write(&file, binary.BigEndian, uint16(2))
+	_ = binary.Write(&file, binary.BigEndian, uint32(payload.Len()))
+	file.Write(payload.Bytes())
+	_ = binary.Write(&file, binary.BigEndian, crc32.ChecksumIEEE(file.Bytes()))
+
+	_, err := Decode(&file)
+	if err == nil || err.Error() != "unsupported mkc version 2, want 3" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestDecodeRejectsBadFiles(t *testing.T) {
+	var buf bytes.Buffer
+	err := Encode(&buf, &File{Bytecode: compile(t, program)})
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name     string
+		modify   func(b []byte) []byte
+		expected string
+	}{
+		{
+			"bad magic",
+			func(b []byte) []byte { b[0] = 'X'; return b },
+			"not an mkc file: bad magic bytes",
+		},
+		{
+			"other version",
+			func(b []byte) []byte {
+				binary.BigEndian.PutUint16(b[len(Magic):], Version+1)
+				return b
+			},
+			"unsupported mkc version 4, want 3",
+		},
+		{
+			"flipped bit",
+			func(b []byte) []byte { b[len(b)/2] ^= 1; return b },
+			"checksum mismatch: file is corrupted",
+		},
+		{
+			"truncated",
+			func(b []byte) []byte { return b[:len(b)-10] },
+			"reading payload: unexpected EOF",
+		},
+		{
+			"empty",
+			func(b []byte) []byte { return nil },
+			"reading header: EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		input := tt.modify(append([]byte{}, valid...))
+
+		_, err := Decode(bytes.NewReader(input))
+		if err == nil {
+			t.Errorf("%s: expected error but got none", tt.name)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err.Error())
+		}
+	}
+}
+
+func equalPositions(a, b map[int]token.Position) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for offset, position := range a {
+		if other, ok := b[offset]; !ok || other != position {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return comp.Bytecode()
+}
@@ -0,0 +1,110 @@
+// Package module loads the modules that programs import from files.
+//
+// Modules are read from a file system supplied by the host, such as an
+// embed.FS, an fstest.MapFS or os.DirFS of a directory, so that programs can
+// only import what the host allows. An import path names a file in it, with
+// or without its .mk extension, as a slash-separated path. Paths are looked
+// up first in the directory of the importing file, then in each directory of
+// the search path in turn.
+package module
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"gocompiler/ast"
+	"gocompiler/eval"
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/parser"
+)
+
+// Extension is the extension of source files, added to import paths that
+// don't have it.
+const Extension = ".mk"
+
+// Loader loads modules from files. It implements compiler.Loader, and names
+// modules after their files.
+type Loader struct {
+	// FS holds the modules. It decides which names are valid: os.DirFS,
+	// embed.FS and fstest.MapFS reject names that leave them. Without a
+	// file system, the zero Loader, every import is denied.
+	FS fs.FS
+	// Main is the file of the main program in FS. Its imports are
+	// relative to its directory, or to the root if it is empty.
+	Main string
+	// SearchPath lists the directories searched for modules that are not
+	// next to the importing file.
+	SearchPath []string
+}
+
+// Load finds the file of the module path imported from the file from, or
+// from Main if from is empty, and parses it, expanding its macros.
+func (l *Loader) Load(path, from string) (string, *ast.Program, error) {
+	file, err := l.find(path, from)
+	if err != nil {
+		return "", nil, err
+	}
+
+	source, err := fs.ReadFile(l.FS, file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	program, err := Parse(source)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return file, program, nil
+}
+
+// find returns the name of the file that the import path name refers to.
+func (l *Loader) find(name, from string) (string, error) {
+	if !strings.HasSuffix(name, Extension) {
+		name += Extension
+	}
+
+	if l.FS == nil {
+		return "", fmt.Errorf("cannot load module %s: %s", name, fs.ErrPermission)
+	}
+
+	if from == "" {
+		from = l.Main
+	}
+
+	dirs := append([]string{path.Dir(from)}, l.SearchPath...)
+	for _, dir := range dirs {
+		file := path.Join(dir, name)
+
+		info, err := fs.Stat(l.FS, file)
+		if err == nil && info.Mode().IsRegular() {
+			return file, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot find module %s", name)
+}
+
+// Parse parses source and expands its macros, which are defined in the
+// source itself.
+func Parse(source []byte) (*ast.Program, error) {
+	p := parser.New(lexer.New(string(source)))
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "; "))
+	}
+
+	env := ir.NewEnvironment()
+	eval.DefineMacros(program, env)
+
+	expanded, err := eval.ExpandMacros(program, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return expanded.(*ast.Program), nil
+}
@@ -0,0 +1,171 @@
+package module
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"gocompiler/compiler"
+	"gocompiler/vm"
+)
+
+// mapFS returns a file system with the given files, which may be in
+// subdirectories.
+func mapFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, source := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(source)}
+	}
+
+	return fsys
+}
+
+func TestLoad(t *testing.T) {
+	loader := &Loader{
+		FS: mapFS(map[string]string{
+			"main.mk":         "",
+			"near.mk":         "export let near = 1;",
+			"sub/inner.mk":    "export let inner = 2;",
+			"lib/far.mk":      "export let far = 3;",
+			"lib/near.mk":     "export let shadowed = 4;",
+			"other/second.mk": "export let second = 5;",
+		}),
+		Main:       "main.mk",
+		SearchPath: []string{"lib", "other"},
+	}
+
+	tests := []struct {
+		path     string
+		from     string
+		expected string
+	}{
+		{"near", "", "near.mk"},
+		{"near.mk", "", "near.mk"},
+		{"sub/inner", "", "sub/inner.mk"},
+		{"far", "", "lib/far.mk"},
+		{"second", "", "other/second.mk"},
+		{"near", "lib/far.mk", "lib/near.mk"},
+		{"../near", "sub/inner.mk", "near.mk"},
+		{"./sub/../near", "", "near.mk"},
+	}
+
+	for _, tt := range tests {
+		name, program, err := loader.Load(tt.path, tt.from)
+		if err != nil {
+			t.Errorf("%s from %q: %s", tt.path, tt.from, err)
+			continue
+		}
+
+		if name != tt.expected {
+			t.Errorf("%s from %q: wrong name. want=%q, got=%q", tt.path, tt.from, tt.expected, name)
+		}
+
+		if len(program.Statements) != 1 {
+			t.Errorf("%s from %q: wrong program: %s", tt.path, tt.from, program)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	loader := &Loader{
+		FS: mapFS(map[string]string{
+			"broken.mk":   "let x = ;",
+			"macro.mk":    "let m = macro() { 1 }; m();",
+			"dir.mk/a.mk": "",
+		}),
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"missing", "cannot find module missing.mk"},
+		{"dir", "cannot find module dir.mk"},
+		{"../broken", "cannot find module ../broken.mk"},
+		{"broken", "broken.mk: no prefix parse function for ; found"},
+		{"macro", "macro.mk: expanding macro m at line 1, column 25: want a quote as result, got Integer"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := loader.Load(tt.path, "")
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.path)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error.\nwant=%q\ngot =%q", tt.path, tt.expected, err)
+		}
+	}
+}
+
+func TestLoadDenied(t *testing.T) {
+	_, _, err := (&Loader{}).Load("lib", "")
+	if err == nil || err.Error() != "cannot load module lib.mk: permission denied" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+// TestLoadDirectory checks that modules can't leave the directory of
+// os.DirFS.
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "secret.mk"), []byte("export let secret = 1;"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "root"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loader := &Loader{FS: os.DirFS(filepath.Join(dir, "root"))}
+
+	for _, path := range []string{"../secret", filepath.ToSlash(filepath.Join(dir, "secret"))} {
+		_, _, err := loader.Load(path, "")
+		if err == nil {
+			t.Errorf("%s: loaded a module outside the directory", path)
+		}
+	}
+
+	_, _, err = (&Loader{FS: os.DirFS(dir)}).Load("secret", "")
+	if err != nil {
+		t.Errorf("module in the directory not loaded: %s", err)
+	}
+}
+
+func TestImportFiles(t *testing.T) {
+	fsys := mapFS(map[string]string{
+		"main.mk":          `import "shapes/square"; import "lib/square"; area(3);`,
+		"shapes/square.mk": `import "../lib/square"; export let area = function(side) { square(side) };`,
+		"lib/square.mk": "let twice = macro(x) { quote(unquote(x) * unquote(x)) };\n" +
+			"export let square = function(x) { twice(x) };",
+	})
+
+	program, err := Parse(fsys["main.mk"].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comp := compiler.NewWithOptions(compiler.Options{Loader: &Loader{FS: fsys, Main: "main.mk"}, File: "main.mk"})
+
+	err = comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+
+	err = machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if result := machine.LastPoppedStackElem().Inspect(); result != "9" {
+		t.Errorf("wrong result. want=9, got=%s", result)
+	}
+}
@@ -37,6 +37,21 @@ const (
 	OpSetLocal
 	OpClosure
 	OpGetFree
+
+	// Wide variants of the opcodes above, used when an operand does not fit
+	// into the regular encoding.
+	OpConstantWide
+	OpGetGlobalWide
+	OpSetGlobalWide
+	OpCallWide
+	OpGetLocalWide
+	OpSetLocalWide
+	OpClosureWide
+	OpGetFreeWide
+
+	OpSlice
+	OpConcat
+	OpGetBuiltin
 )
 
 type Definition struct {
@@ -73,6 +88,39 @@ var definitions = map[Opcode]*Definition{
 	OpGetLocal:      {"OpGetLocal", []int{1}},
 	OpClosure:       {"OpClosure", []int{2, 1}},
 	OpGetFree:       {"OpGetFree", []int{1}},
+
+	OpConstantWide:  {"OpConstantWide", []int{4}},
+	OpGetGlobalWide: {"OpGetGlobalWide", []int{4}},
+	OpSetGlobalWide: {"OpSetGlobalWide", []int{4}},
+	OpCallWide:      {"OpCallWide", []int{2}},
+	OpGetLocalWide:  {"OpGetLocalWide", []int{2}},
+	OpSetLocalWide:  {"OpSetLocalWide", []int{2}},
+	OpClosureWide:   {"OpClosureWide", []int{4, 2}},
+	OpGetFreeWide:   {"OpGetFreeWide", []int{2}},
+
+	OpSlice:  {"OpSlice", []int{}},
+	OpConcat: {"OpConcat", []int{2}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+}
+
+var wideVariants = map[Opcode]Opcode{
+	OpConstant:  OpConstantWide,
+	OpGetGlobal: OpGetGlobalWide,
+	OpSetGlobal: OpSetGlobalWide,
+	OpCall:      OpCallWide,
+	OpGetLocal:  OpGetLocalWide,
+	OpSetLocal:  OpSetLocalWide,
+	OpClosure:   OpClosureWide,
+	OpGetFree:   OpGetFreeWide,
+}
+
+var names = make(map[string]Opcode)
+
+func init() {
+	for op, def := range definitions {
+		names[def.Name] = op
+	}
 }
 
 type Instructions []byte
@@ -86,6 +134,52 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// Wide returns the variant of op with wider operands, if op has one.
+func Wide(op Opcode) (Opcode, bool) {
+	wide, ok := wideVariants[op]
+	return wide, ok
+}
+
+// OperandWidth returns the width in bytes of the i-th operand of op.
+func OperandWidth(op Opcode, i int) int {
+	return definitions[op].OperandWidths[i]
+}
+
+// Width returns the number of bytes taken by the operands of def.
+func (def *Definition) Width() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+
+	return width
+}
+
+// Fits reports whether operands can be encoded without truncation.
+func (def *Definition) Fits(operands ...int) bool {
+	if len(operands) != len(def.OperandWidths) {
+		return false
+	}
+
+	for i, o := range operands {
+		if o < 0 || uint64(o) > maxOperand(def.OperandWidths[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func maxOperand(width int) uint64 {
+	return 1<<(8*uint(width)) - 1
+}
+
+// LookupName returns the opcode with the given mnemonic, e.g. "OpConstant".
+func LookupName(name string) (Opcode, bool) {
+	op, ok := names[name]
+	return op, ok
+}
+
 func Make(op Opcode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
@@ -106,6 +200,8 @@ func Make(op Opcode, operands ...int) []byte {
 	for i, o := range operands {
 		width := def.OperandWidths[i]
 		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
 		case 1:
@@ -123,6 +219,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 
 	for i, width := range def.OperandWidths {
 		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
 		case 1:
@@ -135,6 +233,10 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
@@ -151,10 +253,16 @@ func (ins Instructions) String() string {
 	for i < len(ins) {
 		def, err := Lookup(ins[i])
 		if err != nil {
-			_, _ = fmt.Fprintf(&out, "ERROR: %s\n", err)
+			_, _ = fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
 			continue
 		}
 
+		if i+1+def.Width() > len(ins) {
+			_, _ = fmt.Fprintf(&out, "%04d ERROR: %s is missing operands\n", i, def.Name)
+			break
+		}
+
 		operands, read := ReadOperands(def, ins[i+1:])
 
 		_, _ = fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
@@ -11,6 +11,8 @@ func TestMake(t *testing.T) {
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpPop, []int{}, []byte{byte(OpPop)}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpConstantWide, []int{65536}, []byte{byte(OpConstantWide), 0, 1, 0, 0}},
+		{OpClosureWide, []int{65536, 256}, []byte{byte(OpClosureWide), 0, 1, 0, 0, 1, 0}},
 	}
 
 	for _, tt := range tests {
@@ -64,6 +66,8 @@ func TestReadOperands(t *testing.T) {
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpGetLocalWide, []int{65535}, 2},
+		{OpClosureWide, []int{4294967295, 65535}, 6},
 	}
 
 	for _, tt := range tests {
@@ -86,3 +90,45 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestFits(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected bool
+	}{
+		{OpConstant, []int{65535}, true},
+		{OpConstant, []int{65536}, false},
+		{OpConstant, []int{-1}, false},
+		{OpGetLocal, []int{255}, true},
+		{OpGetLocal, []int{256}, false},
+		{OpGetLocalWide, []int{256}, true},
+		{OpClosure, []int{1, 256}, false},
+		{OpClosureWide, []int{65536, 256}, true},
+		{OpPop, []int{1}, false},
+	}
+
+	for _, tt := range tests {
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		if def.Fits(tt.operands...) != tt.expected {
+			t.Errorf("%s.Fits(%v) wrong. want=%t", def.Name, tt.operands, tt.expected)
+		}
+	}
+}
+
+func TestInstructionsStringMalformed(t *testing.T) {
+	ins := Instructions{255, byte(OpPop), byte(OpConstant), 1}
+
+	expected := `0000 ERROR: opcode 255 undefined
+0001 OpPop
+0002 ERROR: OpConstant is missing operands
+`
+
+	if ins.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
@@ -18,9 +18,14 @@ const (
 	Product       // *
 	Prefix        // -X or !X
 	Call          // myFunction(X)
-	Index         // array[index]
+	Index         // array[index], array[low:high]
 )
 
+// MaxDepth limits how deeply expressions may nest. Deeper input is reported
+// as an error rather than overflowing the stack of the parser or of the
+// passes that walk the tree it produces.
+const MaxDepth = 1 << 12
+
 var precedences = map[token.TokenType]int{
 	token.Equal:       Equals,
 	token.NotEqual:    Equals,
@@ -46,6 +51,8 @@ type Parser struct {
 	currentToken token.Token
 	peekToken    token.Token
 
+	depth int // Nesting depth of the expression being parsed
+
 	prefixParsefunctions map[token.TokenType]prefixParsefunction
 	infixParsefunctions  map[token.TokenType]infixParsefunction
 }
@@ -63,7 +70,9 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LeftParen, p.parseGroupedExpression)
 	p.registerPrefix(token.If, p.parseIfExpression)
 	p.registerPrefix(token.Function, p.parseFunctionLiteral)
+	p.registerPrefix(token.Macro, p.parseMacroLiteral)
 	p.registerPrefix(token.String, p.parseStringLiteral)
+	p.registerPrefix(token.StringStart, p.parseInterpolatedString)
 	p.registerPrefix(token.LeftBracket, p.parseArrayLiteral)
 	p.registerPrefix(token.LeftBrace, p.parseHashLiteral)
 
@@ -107,12 +116,27 @@ func (p *Parser) Errors() []string {
 
 // Statements
 
+// parseStatement returns nil rather than a typed nil pointer when a
+// statement fails to parse, so that callers can drop it.
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
 	case token.Let:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.Return:
 		return p.parseReturnStatement()
+	case token.Import:
+		if stmt := p.parseImportStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.Export:
+		if stmt := p.parseExportStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -155,6 +179,37 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.String) {
+		return nil
+	}
+
+	stmt.Path = p.currentToken.Literal
+
+	if p.peekTokenIs(token.Semicolon) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.Let) {
+		return nil
+	}
+
+	stmt.Statement = p.parseLetStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currentToken}
 
@@ -170,9 +225,16 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // Expressions
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	depth := p.depth
+	defer func() { p.depth = depth }()
+
+	if !p.enterExpression() {
+		return nil
+	}
+
 	prefix := p.prefixParsefunctions[p.currentToken.Type]
 	if prefix == nil {
-		p.noPrefixParsefunctionError(p.currentToken.Type)
+		p.noPrefixParsefunctionError(p.currentToken)
 		return nil
 	}
 
@@ -184,6 +246,12 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 			return leftExp
 		}
 
+		// Each infix expression wraps the ones before it, so a long chain
+		// nests as deeply as the same number of parentheses.
+		if !p.enterExpression() {
+			return nil
+		}
+
 		p.nextToken()
 		leftExp = infix(leftExp)
 	}
@@ -191,6 +259,25 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
+// enterExpression moves one level deeper into an expression. Once MaxDepth
+// is exceeded it reports an error and skips the rest of the input, since
+// the enclosing expressions can no longer be parsed.
+func (p *Parser) enterExpression() bool {
+	p.depth++
+	if p.depth <= MaxDepth {
+		return true
+	}
+
+	msg := fmt.Sprintf("expression nested too deeply at %s", p.currentToken.Position)
+	p.errors = append(p.errors, msg)
+
+	for !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+	}
+
+	return false
+}
+
 // Prefix expressions
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -306,6 +393,24 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.currentToken}
+
+	if !p.expectPeek(token.LeftParen) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LeftBrace) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	var identifiers []*ast.Identifier
 
@@ -314,14 +419,19 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.Identifier) {
+		return nil
+	}
 
 	identifier := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 	identifiers = append(identifiers, identifier)
 
 	for p.peekTokenIs(token.Comma) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.Identifier) {
+			return nil
+		}
+
 		identifier := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
 		identifiers = append(identifiers, identifier)
 	}
@@ -337,6 +447,32 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.currentToken}
+
+	for {
+		if p.currentToken.Literal != "" {
+			str.Parts = append(str.Parts, p.parseStringLiteral())
+		}
+
+		if p.currentTokenIs(token.StringEnd) {
+			return str
+		}
+
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(Lowest))
+
+		if p.peekTokenIs(token.StringMiddle) {
+			p.nextToken()
+			continue
+		}
+
+		if !p.expectPeek(token.StringEnd) {
+			return nil
+		}
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.currentToken}
 
@@ -369,11 +505,35 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseIndexExpression parses both left[index] and left[low:high].
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currentToken, Left: left}
+	tok := p.currentToken
 
-	p.nextToken()
-	exp.Index = p.parseExpression(Lowest)
+	var index ast.Expression
+	if !p.peekTokenIs(token.Colon) {
+		p.nextToken()
+		index = p.parseExpression(Lowest)
+	}
+
+	if p.peekTokenIs(token.Colon) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, index)
+	}
+
+	if !p.expectPeek(token.RightBracket) {
+		return nil
+	}
+
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+func (p *Parser) parseSliceExpression(tok token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+
+	if !p.peekTokenIs(token.RightBracket) {
+		p.nextToken()
+		exp.High = p.parseExpression(Lowest)
+	}
 
 	if !p.expectPeek(token.RightBracket) {
 		return nil
@@ -384,7 +544,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currentToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []ast.HashPair{}
 
 	for !p.peekTokenIs(token.RightBrace) {
 		p.nextToken()
@@ -397,7 +557,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(Lowest)
 
-		hash.Pairs[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
 		if !p.peekTokenIs(token.RightBrace) && !p.expectPeek(token.Comma) {
 			return nil
@@ -461,20 +621,22 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 
 // Precedence
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+// Precedence returns how tightly the infix operator t binds, or Lowest if t
+// is not an infix operator.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 
 	return Lowest
 }
 
-func (p *Parser) currentPrecedence() int {
-	if p, ok := precedences[p.currentToken.Type]; ok {
-		return p
-	}
+func (p *Parser) peekPrecedence() int {
+	return Precedence(p.peekToken.Type)
+}
 
-	return Lowest
+func (p *Parser) currentPrecedence() int {
+	return Precedence(p.currentToken.Type)
 }
 
 // Error
@@ -484,8 +646,14 @@ func (p *Parser) peekError(t token.TokenType) {
 	p.errors = append(p.errors, msg)
 }
 
-func (p *Parser) noPrefixParsefunctionError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
+func (p *Parser) noPrefixParsefunctionError(t token.Token) {
+	if t.Type == token.Illegal {
+		msg := fmt.Sprintf("illegal character %q at %s", t.Literal, t.Position)
+		p.errors = append(p.errors, msg)
+		return
+	}
+
+	msg := fmt.Sprintf("no prefix parse function for %s found", t.Type)
 	p.errors = append(p.errors, msg)
 }
 
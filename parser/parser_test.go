@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"gocompiler/ast"
@@ -68,6 +69,78 @@ func TestReturnStatement(t *testing.T) {
 	}
 }
 
+func TestImportStatement(t *testing.T) {
+	input := `
+		import "lib/math";
+		import "strings"
+	`
+
+	program := createParseProgram(input, t)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	for i, path := range []string{"lib/math", "strings"} {
+		stmt, ok := program.Statements[i].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("stmt not %T. got=%T", &ast.ImportStatement{}, program.Statements[i])
+		}
+
+		if stmt.Path != path {
+			t.Errorf("stmt.Path not %q. got=%q", path, stmt.Path)
+		}
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	program := createParseProgram("export let x = 5;", t)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("stmt not %T. got=%T", &ast.ExportStatement{}, program.Statements[0])
+	}
+
+	if !testLetStatement(t, stmt.Statement, "x") {
+		return
+	}
+
+	testLiteralExpression(t, stmt.Statement.Value, 5)
+}
+
+func TestInvalidImportsAndExports(t *testing.T) {
+	tests := []string{
+		"import lib;",
+		`import "a${b}";`,
+		"export x = 1;",
+		"export let = 1;",
+		"export function() {};",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+
+		for _, stmt := range program.Statements {
+			if stmt == nil {
+				continue
+			}
+
+			if stmt, ok := stmt.(*ast.ExportStatement); ok && stmt == nil {
+				t.Errorf("%q: nil export statement in program", input)
+			}
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -295,6 +368,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * [1, 2, 3, 4][b * c] * d",
 			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
 		},
+		{
+			"a[1:] * b[:-1]",
+			"((a[1:]) * (b[:(-1)]))",
+		},
 		{
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
@@ -472,6 +549,44 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	program := createParseProgram(input, t)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not %T. got=%T", &ast.ExpressionStatement{}, program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not %T. got=%T", &ast.MacroLiteral{}, stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n", len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n", len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not %T. got=%T", &ast.ExpressionStatement{}, macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -523,6 +638,36 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringExpression(t *testing.T) {
+	input := `"value: ${x + 1}, next: ${y}!"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not %T. got=%T", &ast.InterpolatedString{}, stmt.Expression)
+	}
+
+	if len(str.Parts) != 5 {
+		t.Fatalf("str.Parts has wrong length. got=%d", len(str.Parts))
+	}
+
+	testStringLiteral(t, str.Parts[0], "value: ")
+	testInfixExpression(t, str.Parts[1], "x", "+", 1)
+	testStringLiteral(t, str.Parts[2], ", next: ")
+	testIdentifier(t, str.Parts[3], "y")
+	testStringLiteral(t, str.Parts[4], "!")
+
+	expected := "value: ${(x + 1)}, next: ${y}!"
+	if str.String() != expected {
+		t.Errorf("str.String() wrong. want=%q, got=%q", expected, str.String())
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -541,21 +686,27 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not %T. got=%T", ast.StringLiteral{}, key)
+			t.Errorf("key is not %T. got=%T", ast.StringLiteral{}, pair.Key)
+			continue
 		}
 
-		expectedValue := expected[literal.String()]
+		if literal.String() != expected[i].key {
+			t.Errorf("pair %d has wrong key. want=%q, got=%q", i, expected[i].key, literal.String())
+		}
 
-		testIntegerLiteral(t, value, expectedValue)
+		testIntegerLiteral(t, pair.Value, expected[i].value)
 	}
 }
 
@@ -608,10 +759,10 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
 		if !ok {
-			t.Errorf("key is not %T. got=%T", ast.StringLiteral{}, key)
+			t.Errorf("key is not %T. got=%T", ast.StringLiteral{}, pair.Key)
 			continue
 		}
 
@@ -621,7 +772,7 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 			continue
 		}
 
-		testFunc(value)
+		testFunc(pair.Value)
 	}
 }
 
@@ -706,6 +857,134 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		low   interface{}
+		high  interface{}
+	}{
+		{"x[1:2]", 1, 2},
+		{"x[:2]", nil, 2},
+		{"x[1:]", 1, nil},
+		{"x[:]", nil, nil},
+		{"x[a:b]", "a", "b"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not %T. got=%T", &ast.SliceExpression{}, stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "x") {
+			return
+		}
+
+		for _, bound := range []struct {
+			name     string
+			exp      ast.Expression
+			expected interface{}
+		}{{"Low", sliceExp.Low, tt.low}, {"High", sliceExp.High, tt.high}} {
+			if bound.expected == nil {
+				if bound.exp != nil {
+					t.Errorf("%s: %s is not nil. got=%s", tt.input, bound.name, bound.exp)
+				}
+				continue
+			}
+
+			if !testLiteralExpression(t, bound.exp, bound.expected) {
+				return
+			}
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	l := lexer.New("let имя = 5; имя;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	if !testLetStatement(t, program.Statements[0], "имя") {
+		return
+	}
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	testIdentifier(t, stmt.Expression, "имя")
+}
+
+func TestIllegalCharacters(t *testing.T) {
+	l := lexer.New("let x = 1;\nlet y = ∑;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	expected := `illegal character "∑" at line 2, column 9`
+	if errors[0] != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestNestingTooDeep(t *testing.T) {
+	tests := []string{
+		strings.Repeat("(", MaxDepth+1) + "1" + strings.Repeat(")", MaxDepth+1),
+		strings.Repeat("-", MaxDepth+1) + "1",
+		"1" + strings.Repeat(" + 1", MaxDepth),
+		"a" + strings.Repeat("[0]", MaxDepth),
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for nesting depth %d", MaxDepth+1)
+			continue
+		}
+
+		if !strings.HasPrefix(errors[0], "expression nested too deeply at line 1") {
+			t.Errorf("wrong error. got=%q", errors[0])
+		}
+	}
+
+	input := strings.Repeat("(", MaxDepth-1) + "1" + strings.Repeat(")", MaxDepth-1)
+	p := New(lexer.New(input))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestInvalidFunctionParameters(t *testing.T) {
+	tests := []string{
+		"function(1) { }",
+		"function(x, ) { }",
+		"function(x, true) { }",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
 func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	int, ok := il.(*ast.IntegerLiteral)
 	if !ok {
@@ -804,6 +1083,21 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, ope
 	return true
 }
 
+func testStringLiteral(t *testing.T, exp ast.Expression, value string) bool {
+	str, ok := exp.(*ast.StringLiteral)
+	if !ok {
+		t.Errorf("exp not %T. got=%T", &ast.StringLiteral{}, exp)
+		return false
+	}
+
+	if str.Value != value {
+		t.Errorf("str.Value not %q. got=%q", value, str.Value)
+		return false
+	}
+
+	return true
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
@@ -816,3 +1110,40 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func FuzzParseProgram(f *testing.F) {
+	seeds := []string{
+		"let x = 5; let y = true; let foobar = y;",
+		"return 5; return 10; return 993322;",
+		"-a * b + !c == d < e > f != g",
+		"a + add(b * c) + d; add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+		"if (x < y) { x } else { y }",
+		"function(x, y) { x + y; }(1, 2)",
+		`{"one": 0 + 1, "two": 10 - 8}; {}; [1, 2 * 2][1]`,
+		"a[1:] * b[:-1]; c[:]",
+		`"value: ${x + 1}, next: ${y}!"`,
+		"let имя = 5; имя;",
+		"let x = 1;\nlet y = ∑;",
+		"let = ; function(1) { ( [ {",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		for i, stmt := range program.Statements {
+			if stmt == nil {
+				t.Fatalf("statement %d is nil", i)
+			}
+		}
+
+		_ = program.String()
+	})
+}
@@ -1,10 +1,28 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Position Position
+}
+
+// Position is where a token starts in the source. Lines and columns count
+// from 1, and columns count runes rather than bytes.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// IsValid reports whether p is a real position. The zero Position stands for
+// an unknown one.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
 }
 
 const (
@@ -16,6 +34,13 @@ const (
 	Int        = "Int"
 	String     = "String"
 
+	// Parts of an interpolated string such as "a${x}b${y}c": StringStart
+	// is "a", StringMiddle is "b" and StringEnd is "c". The tokens of the
+	// embedded expressions come in between.
+	StringStart  = "StringStart"
+	StringMiddle = "StringMiddle"
+	StringEnd    = "StringEnd"
+
 	// Operators
 	Assign   = "="
 	Plus     = "+"
@@ -43,22 +68,28 @@ const (
 
 	// Keywords
 	Function = "Function"
+	Macro    = "Macro"
 	Let      = "Let"
 	True     = "True"
 	False    = "False"
 	If       = "If"
 	Else     = "Else"
 	Return   = "Return"
+	Import   = "Import"
+	Export   = "Export"
 )
 
 var keywords = map[string]TokenType{
 	"function": Function,
+	"macro":    Macro,
 	"let":      Let,
 	"return":   Return,
 	"true":     True,
 	"false":    False,
 	"if":       If,
 	"else":     Else,
+	"import":   Import,
+	"export":   Export,
 }
 
 func LookupIdentifierType(identifier string) TokenType {
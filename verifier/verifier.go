@@ -0,0 +1,306 @@
+// Package verifier checks bytecode before it is handed to the VM, so that
+// malformed programs, for example ones loaded from a corrupted or hand
+// written file, are rejected with an error instead of crashing the VM.
+package verifier
+
+import (
+	"fmt"
+
+	"gocompiler/compiler"
+	"gocompiler/ir"
+	"gocompiler/opcode"
+)
+
+// Verify checks the main program and every compiled function in the
+// constant pool. It makes sure that
+//   - every instruction is defined and has all of its operands,
+//   - jumps land on instruction boundaries,
+//   - constant, local and free variable indices are in range,
+//   - the stack never underflows and has the same depth whenever two paths
+//     meet, and
+//   - functions return instead of running off their end.
+func Verify(bytecode *compiler.Bytecode) error {
+	v := &verifier{
+		constants: bytecode.Constants,
+		numFree:   make(map[int]int),
+	}
+
+	// The number of free variables of a function is only known from the
+	// OpClosure instructions that reference it.
+	err := v.collectClosures(bytecode)
+	if err != nil {
+		return err
+	}
+
+	err = v.verifyFunction("main program", bytecode.Instructions, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range bytecode.Constants {
+		fn, ok := c.(*ir.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		name := fmt.Sprintf("function (constant %d)", i)
+
+		if fn.NumParameters < 0 || fn.NumLocals < fn.NumParameters {
+			return fmt.Errorf("%s: NumParameters %d exceeds NumLocals %d", name, fn.NumParameters, fn.NumLocals)
+		}
+
+		// A function no OpClosure references, for instance because the
+		// optimizer removed the dead code that created it, never runs and
+		// has an unknown number of free variables.
+		numFree, ok := v.numFree[i]
+		if !ok {
+			numFree = -1
+		}
+
+		err := v.verifyFunction(name, fn.Instructions, fn, numFree)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type verifier struct {
+	constants []ir.Object
+	numFree   map[int]int
+}
+
+type instruction struct {
+	op       opcode.Opcode
+	def      *opcode.Definition
+	operands []int
+	next     int
+}
+
+func (v *verifier) collectClosures(bytecode *compiler.Bytecode) error {
+	all := []opcode.Instructions{bytecode.Instructions}
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*ir.CompiledFunction); ok {
+			all = append(all, fn.Instructions)
+		}
+	}
+
+	for _, ins := range all {
+		decoded, offsets, err := decode(ins)
+		if err != nil {
+			// Reported with more context by verifyFunction.
+			continue
+		}
+
+		for _, offset := range offsets {
+			in := decoded[offset]
+			if in.op != opcode.OpClosure && in.op != opcode.OpClosureWide {
+				continue
+			}
+
+			index, numFree := in.operands[0], in.operands[1]
+			if previous, ok := v.numFree[index]; ok && previous != numFree {
+				return fmt.Errorf("function (constant %d) is used with %d and %d free variables",
+					index, previous, numFree)
+			}
+			v.numFree[index] = numFree
+		}
+	}
+
+	return nil
+}
+
+// decode splits ins into instructions, keyed by their offset.
+func decode(ins opcode.Instructions) (map[int]*instruction, []int, error) {
+	decoded := make(map[int]*instruction)
+	var offsets []int
+
+	for offset := 0; offset < len(ins); {
+		def, err := opcode.Lookup(ins[offset])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%04d: %s", offset, err)
+		}
+
+		if offset+1+def.Width() > len(ins) {
+			return nil, nil, fmt.Errorf("%04d: %s is missing operands", offset, def.Name)
+		}
+
+		operands, read := opcode.ReadOperands(def, ins[offset+1:])
+
+		decoded[offset] = &instruction{
+			op:       opcode.Opcode(ins[offset]),
+			def:      def,
+			operands: operands,
+			next:     offset + 1 + read,
+		}
+		offsets = append(offsets, offset)
+
+		offset += read + 1
+	}
+
+	return decoded, offsets, nil
+}
+
+// verifyFunction checks the instructions of fn, or of the main program if fn
+// is nil.
+func (v *verifier) verifyFunction(name string, ins opcode.Instructions, fn *ir.CompiledFunction, numFree int) error {
+	decoded, offsets, err := decode(ins)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	for _, offset := range offsets {
+		err := v.checkOperands(decoded[offset], decoded, len(ins), fn, numFree)
+		if err != nil {
+			return fmt.Errorf("%s: %04d %s: %s", name, offset, decoded[offset].def.Name, err)
+		}
+	}
+
+	err = checkStack(decoded, len(ins), fn == nil)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	return nil
+}
+
+func (v *verifier) checkOperands(in *instruction, decoded map[int]*instruction, end int, fn *ir.CompiledFunction, numFree int) error {
+	switch in.op {
+	case opcode.OpConstant, opcode.OpConstantWide:
+		if in.operands[0] >= len(v.constants) {
+			return fmt.Errorf("constant index %d out of range (%d constants)", in.operands[0], len(v.constants))
+		}
+	case opcode.OpClosure, opcode.OpClosureWide:
+		if in.operands[0] >= len(v.constants) {
+			return fmt.Errorf("constant index %d out of range (%d constants)", in.operands[0], len(v.constants))
+		}
+		if _, ok := v.constants[in.operands[0]].(*ir.CompiledFunction); !ok {
+			return fmt.Errorf("constant %d is not a function", in.operands[0])
+		}
+	case opcode.OpJump, opcode.OpJumpNotTruthy:
+		target := in.operands[0]
+		if _, ok := decoded[target]; !ok && !(target == end && fn == nil) {
+			return fmt.Errorf("jump target %d is not an instruction boundary", target)
+		}
+	case opcode.OpGetLocal, opcode.OpGetLocalWide, opcode.OpSetLocal, opcode.OpSetLocalWide:
+		if fn == nil {
+			return fmt.Errorf("local variable outside of a function")
+		}
+		if in.operands[0] >= fn.NumLocals {
+			return fmt.Errorf("local index %d out of range (NumLocals %d)", in.operands[0], fn.NumLocals)
+		}
+	case opcode.OpGetFree, opcode.OpGetFreeWide:
+		if numFree >= 0 && in.operands[0] >= numFree {
+			return fmt.Errorf("free index %d out of range (%d free variables)", in.operands[0], numFree)
+		}
+	case opcode.OpGetBuiltin:
+		if in.operands[0] >= len(ir.Builtins) {
+			return fmt.Errorf("builtin index %d out of range (%d builtins)", in.operands[0], len(ir.Builtins))
+		}
+	case opcode.OpHash:
+		if in.operands[0]%2 != 0 {
+			return fmt.Errorf("odd number of hash elements %d", in.operands[0])
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns how many values in takes from the stack and how many it
+// leaves on it.
+func stackEffect(in *instruction) (int, int) {
+	switch in.op {
+	case opcode.OpConstant, opcode.OpConstantWide,
+		opcode.OpTrue, opcode.OpFalse, opcode.OpNull,
+		opcode.OpGetGlobal, opcode.OpGetGlobalWide,
+		opcode.OpGetLocal, opcode.OpGetLocalWide,
+		opcode.OpGetFree, opcode.OpGetFreeWide,
+		opcode.OpGetBuiltin:
+		return 0, 1
+	case opcode.OpPop, opcode.OpJumpNotTruthy,
+		opcode.OpSetGlobal, opcode.OpSetGlobalWide,
+		opcode.OpSetLocal, opcode.OpSetLocalWide,
+		opcode.OpReturnValue:
+		return 1, 0
+	case opcode.OpAdd, opcode.OpSub, opcode.OpMul, opcode.OpDiv,
+		opcode.OpEqual, opcode.OpNotEqual, opcode.OpGreaterThan,
+		opcode.OpIndex:
+		return 2, 1
+	case opcode.OpSlice:
+		return 3, 1
+	case opcode.OpMinus, opcode.OpBang:
+		return 1, 1
+	case opcode.OpArray, opcode.OpHash, opcode.OpConcat:
+		return in.operands[0], 1
+	case opcode.OpCall, opcode.OpCallWide:
+		return in.operands[0] + 1, 1
+	case opcode.OpClosure, opcode.OpClosureWide:
+		return in.operands[1], 1
+	default:
+		return 0, 0
+	}
+}
+
+func successors(in *instruction) []int {
+	switch in.op {
+	case opcode.OpJump:
+		return []int{in.operands[0]}
+	case opcode.OpJumpNotTruthy:
+		return []int{in.next, in.operands[0]}
+	case opcode.OpReturnValue, opcode.OpReturn:
+		return nil
+	default:
+		return []int{in.next}
+	}
+}
+
+// checkStack follows every path through the instructions and tracks the
+// depth of the stack above the locals.
+func checkStack(decoded map[int]*instruction, end int, isMain bool) error {
+	if len(decoded) == 0 {
+		if isMain {
+			return nil
+		}
+		return fmt.Errorf("function has no instructions")
+	}
+
+	depths := map[int]int{0: 0}
+	worklist := []int{0}
+
+	for len(worklist) > 0 {
+		offset := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+
+		in := decoded[offset]
+		depth := depths[offset]
+
+		pop, push := stackEffect(in)
+		if depth < pop {
+			return fmt.Errorf("%04d %s: stack underflow: needs %d values, has %d", offset, in.def.Name, pop, depth)
+		}
+		depth = depth - pop + push
+
+		for _, next := range successors(in) {
+			if next == end {
+				if !isMain {
+					return fmt.Errorf("%04d %s: function ends without returning", offset, in.def.Name)
+				}
+				continue
+			}
+
+			previous, seen := depths[next]
+			if !seen {
+				depths[next] = depth
+				worklist = append(worklist, next)
+				continue
+			}
+
+			if previous != depth {
+				return fmt.Errorf("%04d: stack depth mismatch: %d and %d", next, previous, depth)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package verifier
+
+import (
+	"testing"
+
+	"gocompiler/compiler"
+	"gocompiler/ir"
+	"gocompiler/lexer"
+	"gocompiler/opcode"
+	"gocompiler/parser"
+)
+
+func TestVerifyCompiledPrograms(t *testing.T) {
+	inputs := []string{
+		"",
+		"1 + 2; 3 * 4",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (false) { 10 }",
+		`let a = [1, 2, 3]; let h = {"a": a[0]}; h["a"]`,
+		`let newAdder = function(a, b) {
+			let c = a + b;
+			function(d) {
+				let e = d + c;
+				function(f) { e + f; };
+			};
+		};
+		newAdder(1, 2)(3)(8);`,
+		`let fibonacci = function(x) {
+			if (x == 0) { return 0; } else { if (x == 1) { return 1; } else { fibonacci(x - 1) + fibonacci(x - 2); } }
+		};
+		fibonacci(15);`,
+		"function() { }",
+		"function(a) { if (true) { return a; } function() { a }() }(1)",
+		`function() { assert_eq(1, 1) }()`,
+		"if (true) { return 1; }; 2",
+	}
+
+	for _, input := range inputs {
+		for _, options := range []compiler.Options{{}, {FoldConstants: true, Peephole: true}} {
+			p := parser.New(lexer.New(input))
+			comp := compiler.NewWithOptions(options)
+
+			err := comp.Compile(p.ParseProgram())
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			err = Verify(comp.Bytecode())
+			if err != nil {
+				t.Errorf("valid program %q rejected: %s", input, err)
+			}
+		}
+	}
+}
+
+func TestVerifyRejectsMalformedBytecode(t *testing.T) {
+	function := func(numLocals, numParameters int, ins ...opcode.Instructions) *ir.CompiledFunction {
+		return &ir.CompiledFunction{
+			Instructions:  concat(ins...),
+			NumLocals:     numLocals,
+			NumParameters: numParameters,
+		}
+	}
+
+	tests := []struct {
+		instructions []opcode.Instructions
+		constants    []ir.Object
+		expected     string
+	}{
+		{
+			[]opcode.Instructions{{255}},
+			nil,
+			"main program: 0000: opcode 255 undefined",
+		},
+		{
+			[]opcode.Instructions{{byte(opcode.OpConstant), 0}},
+			nil,
+			"main program: 0000: OpConstant is missing operands",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpGetBuiltin, 200), opcode.Make(opcode.OpPop)},
+			nil,
+			"main program: 0000 OpGetBuiltin: builtin index 200 out of range (5 builtins)",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpConstant, 1), opcode.Make(opcode.OpPop)},
+			[]ir.Object{&ir.Integer{Value: 1}},
+			"main program: 0000 OpConstant: constant index 1 out of range (1 constants)",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpClosure, 0, 0)},
+			[]ir.Object{&ir.Integer{Value: 1}},
+			"main program: 0000 OpClosure: constant 0 is not a function",
+		},
+		{
+			[]opcode.Instructions{
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpJumpNotTruthy, 2),
+				opcode.Make(opcode.OpNull),
+			},
+			nil,
+			"main program: 0001 OpJumpNotTruthy: jump target 2 is not an instruction boundary",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpAdd)},
+			nil,
+			"main program: 0000 OpAdd: stack underflow: needs 2 values, has 0",
+		},
+		{
+			[]opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpTrue),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 8),
+				// 0004
+				opcode.Make(opcode.OpNull),
+				// 0005
+				opcode.Make(opcode.OpJump, 8),
+				// 0008
+				opcode.Make(opcode.OpNull),
+				// 0009
+				opcode.Make(opcode.OpPop),
+			},
+			nil,
+			"main program: 0008: stack depth mismatch: 0 and 1",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpGetLocal, 0)},
+			nil,
+			"main program: 0000 OpGetLocal: local variable outside of a function",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpClosure, 0, 0)},
+			[]ir.Object{function(1, 1,
+				opcode.Make(opcode.OpGetLocal, 1),
+				opcode.Make(opcode.OpReturnValue),
+			)},
+			"function (constant 0): 0000 OpGetLocal: local index 1 out of range (NumLocals 1)",
+		},
+		{
+			[]opcode.Instructions{
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpClosure, 0, 1),
+			},
+			[]ir.Object{function(0, 0,
+				opcode.Make(opcode.OpGetFree, 1),
+				opcode.Make(opcode.OpReturnValue),
+			)},
+			"function (constant 0): 0000 OpGetFree: free index 1 out of range (1 free variables)",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpClosure, 0, 0)},
+			[]ir.Object{function(0, 0,
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpPop),
+			)},
+			"function (constant 0): 0001 OpPop: function ends without returning",
+		},
+		{
+			[]opcode.Instructions{opcode.Make(opcode.OpClosure, 0, 0)},
+			[]ir.Object{function(0, 2, opcode.Make(opcode.OpReturn))},
+			"function (constant 0): NumParameters 2 exceeds NumLocals 0",
+		},
+		{
+			[]opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0, 0),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpClosure, 0, 1),
+			},
+			[]ir.Object{function(0, 0, opcode.Make(opcode.OpReturn))},
+			"function (constant 0) is used with 0 and 1 free variables",
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := &compiler.Bytecode{
+			Instructions: concat(tt.instructions...),
+			Constants:    tt.constants,
+		}
+
+		err := Verify(bytecode)
+		if err == nil {
+			t.Errorf("expected error %q but got none", tt.expected)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error.\nwant=%q\ngot=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func concat(s ...opcode.Instructions) opcode.Instructions {
+	out := opcode.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
@@ -2,66 +2,188 @@ package vm
 
 import (
 	"fmt"
+	"io/fs"
+	"strings"
 
 	"gocompiler/compiler"
 	"gocompiler/ir"
 	"gocompiler/opcode"
+	"gocompiler/token"
 )
 
-const StackSize = 2048
-const GlobalSize = 65536
-const MaxFrames = 2048
+const (
+	initialStackSize   = 64
+	initialFramesSize  = 16
+	initialGlobalsSize = 16
+)
+
+// Config limits how far the value stack, the frame stack and the globals may
+// grow. All of them start small and are grown on demand. MaxInstructions
+// bounds the number of instructions Run executes; zero means no bound.
+type Config struct {
+	MaxStackSize    int
+	MaxFrames       int
+	MaxGlobals      int
+	MaxInstructions int
+
+	// FS holds the files that builtins such as read_file may read. Nil,
+	// the default, denies access to all files.
+	FS fs.FS
+}
+
+var DefaultConfig = Config{
+	MaxStackSize: 1 << 20,
+	MaxFrames:    1 << 16,
+	MaxGlobals:   65536,
+}
 
 var True = &ir.Boolean{Value: true}
 var False = &ir.Boolean{Value: false}
 var Null = &ir.Null{}
 
+// operators maps the opcodes of binary operations to their operators, for
+// error messages. Since a < b compiles to b > a, there is no entry for <.
+var operators = map[opcode.Opcode]string{
+	opcode.OpAdd:         "+",
+	opcode.OpSub:         "-",
+	opcode.OpMul:         "*",
+	opcode.OpDiv:         "/",
+	opcode.OpEqual:       "==",
+	opcode.OpNotEqual:    "!=",
+	opcode.OpGreaterThan: ">",
+}
+
 type VM struct {
+	config Config
+
 	constants   []ir.Object
 	stack       []ir.Object
 	sp          int // Always points to the next value. Top of stack is stack[sp-1]
 	globals     []ir.Object
 	frames      []*Frame
 	framesIndex int
+
+	instructions int // Number of instructions executed so far
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	frames := make([]*Frame, MaxFrames)
+	return NewWithConfig(bytecode, DefaultConfig)
+}
+
+// NewWithConfig creates a VM with the given limits. Zero fields of config
+// fall back to the values from DefaultConfig.
+func NewWithConfig(bytecode *compiler.Bytecode, config Config) *VM {
+	if config.MaxStackSize <= 0 {
+		config.MaxStackSize = DefaultConfig.MaxStackSize
+	}
+	if config.MaxFrames <= 0 {
+		config.MaxFrames = DefaultConfig.MaxFrames
+	}
+	if config.MaxGlobals <= 0 {
+		config.MaxGlobals = DefaultConfig.MaxGlobals
+	}
+
+	frames := make([]*Frame, initialFramesSize)
 	frames[0] = NewFrame(
 		&ir.Closure{
 			Function: &ir.CompiledFunction{
 				Instructions: bytecode.Instructions,
+				Positions:    bytecode.Positions,
 			}}, 0)
 
 	return &VM{
+		config:      config,
 		constants:   bytecode.Constants,
-		stack:       make([]ir.Object, StackSize),
+		stack:       make([]ir.Object, initialStackSize),
 		sp:          0,
-		globals:     make([]ir.Object, GlobalSize),
+		globals:     make([]ir.Object, initialGlobalsSize),
 		frames:      frames,
 		framesIndex: 1,
 	}
 }
 
+// RuntimeError is an error that stopped the VM. Position is where in the
+// source the failing instruction came from, if the compiler recorded it, and
+// File the module it is in, empty for the main program; the message itself
+// doesn't include either.
+type RuntimeError struct {
+	Message  string
+	Position token.Position
+	File     string
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+
+// Run runs the program. Errors are of type *RuntimeError.
 func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// FS returns the files that builtins may read, from the config of the VM.
+func (vm *VM) FS() fs.FS {
+	return vm.config.FS
+}
+
+// Call calls fn with args from within a builtin and returns its result. If
+// the call fails, the VM is left as it was before the call.
+func (vm *VM) Call(fn ir.Object, args ...ir.Object) (ir.Object, error) {
+	sp, framesIndex := vm.sp, vm.framesIndex
+
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		err = vm.push(arg)
+	}
+
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+
+	if err == nil && vm.framesIndex > framesIndex {
+		err = vm.run(framesIndex)
+	}
+
+	if err != nil {
+		vm.sp, vm.framesIndex = sp, framesIndex
+		return nil, err
+	}
+
+	return vm.pop(), nil
+}
+
+// run executes instructions until the frame at index stop returns, or until
+// the main program ends if stop is 0.
+func (vm *VM) run(stop int) (err error) {
 	var (
 		ip  int
 		ins opcode.Instructions
 		op  opcode.Opcode
 	)
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	defer func() {
+		if err != nil {
+			err = vm.runtimeError(err, ip)
+		}
+	}()
+
+	for vm.framesIndex > stop && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 
+		vm.instructions++
+		if vm.config.MaxInstructions > 0 && vm.instructions > vm.config.MaxInstructions {
+			return fmt.Errorf("execution limit: MaxInstructions (%d) exceeded", vm.config.MaxInstructions)
+		}
+
 		op = opcode.Opcode(ins[ip])
 
 		switch op {
-		case opcode.OpConstant:
-			constIndex := opcode.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+		case opcode.OpConstant, opcode.OpConstantWide:
+			constIndex := vm.readOperand(opcode.OperandWidth(op, 0))
 
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
@@ -115,16 +237,17 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case opcode.OpSetGlobal:
-			globalIndex := opcode.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+		case opcode.OpSetGlobal, opcode.OpSetGlobalWide:
+			globalIndex := vm.readOperand(opcode.OperandWidth(op, 0))
 
-			vm.globals[globalIndex] = vm.pop()
-		case opcode.OpGetGlobal:
-			globalIndex := opcode.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			err := vm.setGlobal(globalIndex, vm.pop())
+			if err != nil {
+				return err
+			}
+		case opcode.OpGetGlobal, opcode.OpGetGlobalWide:
+			globalIndex := vm.readOperand(opcode.OperandWidth(op, 0))
 
-			err := vm.push(vm.globals[globalIndex])
+			err := vm.push(vm.getGlobal(globalIndex))
 			if err != nil {
 				return err
 			}
@@ -153,6 +276,17 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case opcode.OpConcat:
+			numParts := int(opcode.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := vm.buildString(vm.sp-numParts, vm.sp)
+			vm.sp = vm.sp - numParts
+
+			err := vm.push(str)
+			if err != nil {
+				return err
+			}
 		case opcode.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -161,17 +295,30 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case opcode.OpCall:
-			numArgs := opcode.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+		case opcode.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSliceExpression(left, low, high)
+			if err != nil {
+				return err
+			}
+		case opcode.OpCall, opcode.OpCallWide:
+			numArgs := vm.readOperand(opcode.OperandWidth(op, 0))
 
-			err := vm.executeCall(int(numArgs))
+			err := vm.executeCall(numArgs)
 			if err != nil {
 				return err
 			}
 		case opcode.OpReturnValue:
 			returnValue := vm.pop()
 
+			if vm.framesIndex == 1 {
+				vm.returnFromMain(returnValue)
+				return nil
+			}
+
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -180,6 +327,11 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case opcode.OpReturn:
+			if vm.framesIndex == 1 {
+				vm.returnFromMain(Null)
+				return nil
+			}
+
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -187,48 +339,85 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case opcode.OpSetLocal:
-			localIndex := opcode.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+		case opcode.OpSetLocal, opcode.OpSetLocalWide:
+			localIndex := vm.readOperand(opcode.OperandWidth(op, 0))
 
 			frame := vm.currentFrame()
 
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
-		case opcode.OpGetLocal:
-			localIndex := opcode.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			vm.stack[frame.basePointer+localIndex] = vm.pop()
+		case opcode.OpGetLocal, opcode.OpGetLocalWide:
+			localIndex := vm.readOperand(opcode.OperandWidth(op, 0))
 
 			frame := vm.currentFrame()
 
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			err := vm.push(vm.stack[frame.basePointer+localIndex])
 			if err != nil {
 				return err
 			}
-		case opcode.OpClosure:
-			constIndex := opcode.ReadUint16(ins[ip+1:])
-			numFree := opcode.ReadUint8(ins[ip+3:])
-			vm.currentFrame().ip += 3
+		case opcode.OpClosure, opcode.OpClosureWide:
+			constIndex := vm.readOperand(opcode.OperandWidth(op, 0))
+			numFree := vm.readOperand(opcode.OperandWidth(op, 1))
 
-			err := vm.pushClosure(int(constIndex), int(numFree))
+			err := vm.pushClosure(constIndex, numFree)
 			if err != nil {
 				return err
 			}
 
-		case opcode.OpGetFree:
-			freeIndex := opcode.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+		case opcode.OpGetFree, opcode.OpGetFreeWide:
+			freeIndex := vm.readOperand(opcode.OperandWidth(op, 0))
 
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure.Free[freeIndex])
 			if err != nil {
 				return err
 			}
+		case opcode.OpGetBuiltin:
+			builtinIndex := vm.readOperand(1)
+
+			err := vm.push(ir.Builtins[builtinIndex])
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// runtimeError turns err into a *RuntimeError that points at the source of
+// the instruction at ip in the current frame. Errors raised by a nested
+// call already point at the instruction that failed and are kept.
+func (vm *VM) runtimeError(err error, ip int) error {
+	if _, ok := err.(*RuntimeError); ok {
+		return err
+	}
+
+	fn := vm.currentFrame().cl.Function
+	return &RuntimeError{Message: err.Error(), Position: fn.Positions[ip], File: fn.File}
+}
+
+// readOperand reads an operand of the given width that follows the current
+// instruction and advances the instruction pointer past it.
+func (vm *VM) readOperand(width int) int {
+	frame := vm.currentFrame()
+	ins := frame.Instructions()[frame.ip+1:]
+
+	var operand int
+
+	switch width {
+	case 4:
+		operand = int(opcode.ReadUint32(ins))
+	case 2:
+		operand = int(opcode.ReadUint16(ins))
+	case 1:
+		operand = int(opcode.ReadUint8(ins))
+	}
+
+	frame.ip += width
+
+	return operand
+}
+
 func (vm *VM) StackTop() ir.Object {
 	if vm.sp == 0 {
 		return nil
@@ -237,6 +426,16 @@ func (vm *VM) StackTop() ir.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// returnFromMain ends the main program, which returned value, leaving value
+// behind as its result, as the evaluator does.
+func (vm *VM) returnFromMain(value ir.Object) {
+	vm.stack[0] = value
+	vm.sp = 0
+
+	frame := vm.currentFrame()
+	frame.ip = len(frame.Instructions()) - 1
+}
+
 func (vm *VM) LastPoppedStackElem() ir.Object {
 	return vm.stack[vm.sp]
 }
@@ -248,8 +447,9 @@ func (vm *VM) pop() ir.Object {
 }
 
 func (vm *VM) push(o ir.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+	err := vm.ensureStack(vm.sp + 1)
+	if err != nil {
+		return err
 	}
 
 	vm.stack[vm.sp] = o
@@ -258,6 +458,60 @@ func (vm *VM) push(o ir.Object) error {
 	return nil
 }
 
+// ensureStack grows the value stack so that it holds at least size slots.
+func (vm *VM) ensureStack(size int) error {
+	if size > vm.config.MaxStackSize {
+		return fmt.Errorf("stack overflow: MaxStackSize (%d) exceeded", vm.config.MaxStackSize)
+	}
+
+	if size <= len(vm.stack) {
+		return nil
+	}
+
+	newSize := len(vm.stack) * 2
+	for newSize < size {
+		newSize *= 2
+	}
+	if newSize > vm.config.MaxStackSize {
+		newSize = vm.config.MaxStackSize
+	}
+
+	stack := make([]ir.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+func (vm *VM) setGlobal(index int, o ir.Object) error {
+	if index >= len(vm.globals) {
+		if index >= vm.config.MaxGlobals {
+			return fmt.Errorf("too many globals: MaxGlobals (%d) exceeded", vm.config.MaxGlobals)
+		}
+
+		newSize := len(vm.globals) * 2
+		for newSize <= index {
+			newSize *= 2
+		}
+
+		globals := make([]ir.Object, newSize)
+		copy(globals, vm.globals)
+		vm.globals = globals
+	}
+
+	vm.globals[index] = o
+
+	return nil
+}
+
+func (vm *VM) getGlobal(index int) ir.Object {
+	if index >= len(vm.globals) || vm.globals[index] == nil {
+		return Null
+	}
+
+	return vm.globals[index]
+}
+
 func (vm *VM) executeBinaryOperation(op opcode.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -289,9 +543,12 @@ func (vm *VM) executeBinaryIntegerOperation(op opcode.Opcode, left, right ir.Obj
 	case opcode.OpMul:
 		result = leftValue * rightValue
 	case opcode.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
 	}
 
 	return vm.push(&ir.Integer{Value: result})
@@ -299,7 +556,7 @@ func (vm *VM) executeBinaryIntegerOperation(op opcode.Opcode, left, right ir.Obj
 
 func (vm *VM) executeBinaryStringOperation(op opcode.Opcode, left, right ir.Object) error {
 	if op != opcode.OpAdd {
-		return fmt.Errorf("unknown string operator: %d", op)
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
 	}
 
 	leftValue := left.(*ir.String).Value
@@ -312,17 +569,20 @@ func (vm *VM) executeComparison(op opcode.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	if left.Type() == ir.IntegerObj || right.Type() == ir.IntegerObj {
+	switch {
+	case left.Type() == ir.IntegerObj && right.Type() == ir.IntegerObj:
 		return vm.executeIntegerComparison(op, left, right)
+	case left.Type() == ir.StringObj && right.Type() == ir.StringObj:
+		return vm.executeStringComparison(op, left, right)
 	}
 
 	switch op {
 	case opcode.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(ir.Equal(left, right)))
 	case opcode.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!ir.Equal(left, right)))
 	default:
-		return fmt.Errorf("unknown operator: %d %s %s", op, left.Type(), right.Type())
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
 	}
 }
 
@@ -338,7 +598,23 @@ func (vm *VM) executeIntegerComparison(op opcode.Opcode, left, right ir.Object)
 	case opcode.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
 	default:
-		return fmt.Errorf("unknown operator: %d", op)
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeStringComparison(op opcode.Opcode, left, right ir.Object) error {
+	leftValue := left.(*ir.String).Value
+	rightValue := right.(*ir.String).Value
+
+	switch op {
+	case opcode.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case opcode.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case opcode.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
 	}
 }
 
@@ -372,6 +648,8 @@ func (vm *VM) executeIndexExpression(left, index ir.Object) error {
 	switch {
 	case left.Type() == ir.ArrayObj && index.Type() == ir.IntegerObj:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == ir.StringObj && index.Type() == ir.IntegerObj:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == ir.HashObj:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -379,6 +657,101 @@ func (vm *VM) executeIndexExpression(left, index ir.Object) error {
 	}
 }
 
+// executeStringIndex indexes strings by rune, not by byte.
+func (vm *VM) executeStringIndex(str, index ir.Object) error {
+	runes := []rune(str.(*ir.String).Value)
+	i := index.(*ir.Integer).Value
+
+	if i < 0 || i >= int64(len(runes)) {
+		return vm.push(Null)
+	}
+
+	return vm.push(&ir.String{Value: string(runes[i])})
+}
+
+// executeSliceExpression slices arrays by element and strings by rune.
+// Negative bounds count from the end, and bounds that are out of range
+// after that give null, like out-of-range indices do.
+func (vm *VM) executeSliceExpression(left, low, high ir.Object) error {
+	switch left := left.(type) {
+	case *ir.Array:
+		start, end, ok, err := sliceBounds(len(left.Elements), low, high)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return vm.push(Null)
+		}
+
+		elements := make([]ir.Object, end-start)
+		copy(elements, left.Elements[start:end])
+
+		return vm.push(&ir.Array{Elements: elements})
+	case *ir.String:
+		runes := []rune(left.Value)
+
+		start, end, ok, err := sliceBounds(len(runes), low, high)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return vm.push(Null)
+		}
+
+		return vm.push(&ir.String{Value: string(runes[start:end])})
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+}
+
+// sliceBounds resolves the bounds of a slice of something with length
+// elements. A null bound is omitted. It reports false when the bounds are
+// out of range.
+func sliceBounds(length int, low, high ir.Object) (int, int, bool, error) {
+	bound := func(obj ir.Object, omitted int) (int, error) {
+		if obj == Null {
+			return omitted, nil
+		}
+
+		integer, ok := obj.(*ir.Integer)
+		if !ok {
+			return 0, fmt.Errorf("slice bound must be %s, got %s", ir.IntegerObj, obj.Type())
+		}
+
+		i := integer.Value
+		if i < 0 {
+			i += int64(length)
+		}
+
+		// Anything out of range is rejected below; clamp it so that it
+		// converts to int safely.
+		if i < 0 {
+			return -1, nil
+		}
+		if i > int64(length) {
+			return length + 1, nil
+		}
+
+		return int(i), nil
+	}
+
+	start, err := bound(low, 0)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	end, err := bound(high, length)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	if start < 0 || end > length || start > end {
+		return 0, 0, false, nil
+	}
+
+	return start, end, true, nil
+}
+
 func (vm *VM) executeHashIndex(hash, index ir.Object) error {
 	hashObject := hash.(*ir.Hash)
 
@@ -387,12 +760,12 @@ func (vm *VM) executeHashIndex(hash, index ir.Object) error {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return vm.push(Null)
 	}
 
-	return vm.push(pair.Value)
+	return vm.push(value)
 }
 
 func (vm *VM) executeArrayIndex(array, index ir.Object) error {
@@ -408,24 +781,35 @@ func (vm *VM) executeArrayIndex(array, index ir.Object) error {
 	return vm.push(arrayObject.Elements[i])
 }
 
+// buildString concatenates the values on the stack between startIndex and
+// endIndex. Strings contribute their value, everything else its Inspect
+// output.
+func (vm *VM) buildString(startIndex, endIndex int) ir.Object {
+	var out strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		out.WriteString(vm.stack[i].Inspect())
+	}
+
+	return &ir.String{Value: out.String()}
+}
+
 func (vm *VM) buildHash(startIndex, endIndex int) (ir.Object, error) {
-	hashedPairs := make(map[ir.HashKey]ir.HashPair)
+	hash := ir.NewHash()
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		pair := ir.HashPair{Key: key, Value: value}
-
 		hashKey, ok := key.(ir.Hashable)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
 
-	return &ir.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) ir.Object {
@@ -443,9 +827,19 @@ func (vm *VM) popFrame() *Frame {
 	return vm.frames[vm.framesIndex]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
-	vm.frames[vm.framesIndex] = f
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= vm.config.MaxFrames {
+		return fmt.Errorf("stack overflow: MaxFrames (%d) exceeded", vm.config.MaxFrames)
+	}
+
+	if vm.framesIndex >= len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
 	vm.framesIndex++
+
+	return nil
 }
 
 func (vm *VM) currentFrame() *Frame {
@@ -457,8 +851,13 @@ func (vm *VM) executeCall(numArgs int) error {
 	switch callee := callee.(type) {
 	case *ir.Closure:
 		return vm.callClosure(callee, numArgs)
+	case *ir.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	case nil:
+		// Only a stack slot that was never written holds nothing.
+		return fmt.Errorf("not a function: unset value")
 	default:
-		return fmt.Errorf("calling non-function and non-built-in")
+		return fmt.Errorf("not a function: %s", callee.Type())
 	}
 }
 
@@ -488,12 +887,46 @@ func (vm *VM) callClosure(cl *ir.Closure, numArgs int) error {
 	}
 
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+
+	err := vm.ensureStack(frame.basePointer + cl.Function.NumLocals)
+	if err != nil {
+		return err
+	}
+
+	err = vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	// Locals are null until they are set, rather than whatever an earlier
+	// call left behind.
+	for i := vm.sp; i < frame.basePointer+cl.Function.NumLocals; i++ {
+		vm.stack[i] = Null
+	}
+
 	vm.sp = frame.basePointer + cl.Function.NumLocals
 
 	return nil
 }
 
+func (vm *VM) callBuiltin(builtin *ir.Builtin, numArgs int) error {
+	args := make([]ir.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result, err := builtin.Fn(vm, args...)
+	if err != nil {
+		return err
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+
+	if result == nil {
+		result = Null
+	}
+
+	return vm.push(result)
+}
+
 func nativeBoolToBooleanObject(input bool) *ir.Boolean {
 	if input {
 		return True
@@ -2,13 +2,19 @@ package vm
 
 import (
 	"fmt"
+	"io/fs"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"gocompiler/asm"
 	"gocompiler/ast"
 	"gocompiler/compiler"
 	"gocompiler/ir"
 	"gocompiler/lexer"
 	"gocompiler/parser"
+	"gocompiler/token"
+	"gocompiler/verifier"
 )
 
 type vmTestCase struct {
@@ -85,6 +91,11 @@ func TestConditionals(t *testing.T) {
 		{"if (1 > 2) { 10 }", Null},
 		{"if (false) { 10 }", Null},
 		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { }", Null},
+		{"if (true) { let x = 10; }", Null},
+		{"if (false) { 10 } else { let x = 20; }", Null},
+		{"if (false) { } else { 20 }", 20},
+		{"let f = function() { if (true) { let x = 10; } }; [f(), 30][1]", 30},
 	}
 
 	runVmTests(t, tests)
@@ -110,6 +121,60 @@ func TestStringExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`"${1}"`, "1"},
+		{`let x = 41; "value: ${x + 1}"`, "value: 42"},
+		{`"${"a"}${true}${[1, "b"]}"`, "a" + "true" + "[1, b]"},
+		{`let name = "monkey"; "hello, ${name}!"`, "hello, monkey!"},
+		{`"${ {"k": "${1}${2}"}["k"] } and ${if (false) { 1 }}"`, "12 and null"},
+		{`let f = function(x) { "<${x}>" }; f(f("a"))`, "<<a>>"},
+		{`let x = 1; "$$ $${x} $$${x}"`, "$$ ${x} $1"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringComparisons(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a" == "a"`, true},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"mon" + "key" != "monkey"`, false},
+		{`"monkey" == "banana"`, false},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"a" < "a"`, false},
+		{`"ab" > "a"`, true},
+		{`"B" < "a"`, true},
+		{`let a = "x"; let b = "x"; a + "y" == b + "y"`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[] == []", true},
+		{`[[1, "a"], [true]] == [[1, "a"], [true]]`, true},
+		{`[[1, "a"], [true]] == [[1, "a"], [false]]`, false},
+		{"{1: 2, 3: 4} == {3: 4, 1: 2}", true},
+		{"{1: 2, 3: 4} == {1: 2, 3: 5}", false},
+		{"{1: 2} == {1: 2, 3: 4}", false},
+		{`{"a": [1], "b": {1: 2}} == {"b": {1: 2}, "a": [1]}`, true},
+		{"[1] == {}", false},
+		{"1 == true", false},
+		{`1 != "1"`, true},
+		{"let f = function() { 1 }; f == f", true},
+		{"function() { 1 } == function() { 1 }", false},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestArrayLiterals(t *testing.T) {
 	tests := []vmTestCase{
 		{"[]", []int{}},
@@ -144,6 +209,36 @@ func TestHashLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestHashInspectOrder(t *testing.T) {
+	tests := []vmTestCase{
+		{`{3: 1, 1: 2, 2: 3}`, "{3: 1, 1: 2, 2: 3}"},
+		{`{"b": 1, "a": 2, "b": 3}`, "{b: 3, a: 2}"},
+		{`{true: [1], false: {}}`, "{true: [1], false: {}}"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		result := vm.LastPoppedStackElem().Inspect()
+		if result != tt.expected {
+			t.Errorf("wrong Inspect() for %s. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"[1, 2, 3][1]", 2},
@@ -156,6 +251,36 @@ func TestIndexExpressions(t *testing.T) {
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{`"abc"[1]`, "b"},
+		{`"abc"[3]`, Null},
+		{`"héllo"[1]`, "é"},
+		{`"世界"[1]`, "界"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][-3:-1]", []int{2, 3}},
+		{"[1, 2, 3, 4][2:2]", []int{}},
+		{"[1, 2, 3, 4][3:1]", Null},
+		{"[1, 2, 3, 4][0:5]", Null},
+		{"[1, 2, 3, 4][-5:]", Null},
+		{"[][:]", []int{}},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[3:]`, "key"},
+		{`"monkey"[:-3]`, "mon"},
+		{`"héllo, 世界"[1:4]`, "éll"},
+		{`"héllo, 世界"[-2:]`, "世界"},
+		{`"monkey"[7:]`, Null},
+		{"let a = [1, 2, 3]; let b = a[1:]; a[1]", 2},
 	}
 
 	runVmTests(t, tests)
@@ -295,6 +420,268 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`assert(true)`, Null},
+		{`assert(1, "ones are truthy")`, Null},
+		{`assert_eq([1, "a"], [1, "a"])`, Null},
+		{`assert_error(function() { 1 / 0 })`, Null},
+		{`assert_error(function() { 1 / 0 }, "division by zero")`, Null},
+		{`let f = function(x) { assert_error(function() { x() }); x }; f(1)`, 1},
+		{`let assert = function(x) { x * 2 }; assert(2)`, 4},
+		{`len("")`, 0},
+		{`len("héllo, 世界")`, 9},
+		{`len([1, [2, 3]])`, 2},
+		{`len({"a": 1, "b": 2, "a": 3})`, 2},
+		{`let s = "世界"; s[len(s) - 1]`, "界"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReadFile(t *testing.T) {
+	files := fstest.MapFS{
+		"hello.txt":     {Data: []byte("hello")},
+		"dir/world.txt": {Data: []byte("world")},
+	}
+
+	tests := []struct {
+		input    string
+		fs       fs.FS
+		expected string
+	}{
+		{`read_file("hello.txt")`, files, "hello"},
+		{`read_file("dir/world.txt")`, files, "world"},
+		{`read_file("hello.txt")`, nil, "cannot read hello.txt: permission denied"},
+		{`read_file("missing.txt")`, files, "cannot read missing.txt: file does not exist"},
+		{`read_file("../hello.txt")`, files, "cannot read ../hello.txt: file does not exist"},
+		{`read_file("dir")`, files, "cannot read dir: invalid argument"},
+		{`read_file(1)`, files, "argument to read_file must be String, got Integer"},
+		{`read_file()`, files, "wrong number of arguments: want=1, got=0"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithConfig(comp.Bytecode(), Config{FS: tt.fs})
+
+		err = vm.Run()
+		if err != nil {
+			if err.Error() != tt.expected {
+				t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+			}
+			continue
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestCallNothing(t *testing.T) {
+	vm := New(&compiler.Bytecode{})
+
+	err := vm.push(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = vm.executeCall(0)
+	if err == nil || err.Error() != "not a function: unset value" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		position token.Position
+	}{
+		{
+			input:    "assert(false)",
+			expected: "assertion failed",
+			position: token.Position{Line: 1, Column: 7},
+		},
+		{
+			input:    "let x = 1;\nassert(x == 2, \"x is two\")",
+			expected: "assertion failed: x is two",
+			position: token.Position{Line: 2, Column: 7},
+		},
+		{
+			input:    "let check = function(x) {\n  assert_eq(x + 1, 3)\n};\ncheck(1)",
+			expected: "assertion failed: got 2, want 3",
+			position: token.Position{Line: 2, Column: 12},
+		},
+		{
+			input:    "assert_error(function() { 1 })",
+			expected: "assertion failed: want an error, got 1",
+			position: token.Position{Line: 1, Column: 13},
+		},
+		{
+			input:    `assert_error(function() { 1 / 0 }, "oops")`,
+			expected: `assertion failed: want error "oops", got "division by zero"`,
+			position: token.Position{Line: 1, Column: 13},
+		},
+		{
+			input:    "assert_error(function() { assert_eq(1, 1) }())",
+			expected: "argument to assert_error must be a function, got Null",
+			position: token.Position{Line: 1, Column: 13},
+		},
+		{
+			input:    `assert(true, 1)`,
+			expected: "message must be String, got Integer",
+			position: token.Position{Line: 1, Column: 7},
+		},
+		{
+			input:    "len(1)",
+			expected: "argument to len not supported: Integer",
+			position: token.Position{Line: 1, Column: 4},
+		},
+		{
+			input:    `assert_eq(1)`,
+			expected: "wrong number of arguments: want=2, got=1",
+			position: token.Position{Line: 1, Column: 10},
+		},
+		{
+			input:    "let f = function() { [] + 1 };\nf()",
+			expected: "unsupported types for binary operation: Array Integer",
+			position: token.Position{Line: 1, Column: 25},
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("%q: expected VM error but resulted in none.", tt.input)
+		}
+
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("%q: error is not *RuntimeError. got=%T", tt.input, err)
+		}
+
+		if runtimeErr.Message != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, runtimeErr.Message)
+		}
+
+		if runtimeErr.Position != tt.position {
+			t.Errorf("%q: wrong position: want=%s, got=%s", tt.input, tt.position, runtimeErr.Position)
+		}
+	}
+}
+
+// moduleLoader loads modules from a map from names to source.
+type moduleLoader map[string]string
+
+func (l moduleLoader) Load(path, from string) (string, *ast.Program, error) {
+	input, ok := l[path]
+	if !ok {
+		return "", nil, fmt.Errorf("no module %s", path)
+	}
+
+	return path, parse(input), nil
+}
+
+func TestModules(t *testing.T) {
+	loader := moduleLoader{
+		"counter": `
+			let count = 0;
+			export let next = function() { count + 1 };
+		`,
+		"double": `import "counter"; export let double = function(x) { x * 2 };`,
+		"fail":   "export let fail = function() {\n  1 / 0\n};",
+		"assert": "export let assert = 3;",
+	}
+
+	tests := []vmTestCase{
+		{`import "counter"; next()`, 1},
+		{`import "double"; double(21)`, 42},
+		{`import "double"; import "counter"; double(next())`, 2},
+		{`import "counter"; import "counter"; next()`, 1},
+		{`import "assert"; assert`, 3},
+		{`import "counter"; let next = 5; next`, 5},
+		{`let count = 7; import "counter"; count + next()`, 8},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewWithOptions(compiler.Options{Loader: loader})
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+
+	comp := compiler.NewWithOptions(compiler.Options{Loader: loader})
+	err := comp.Compile(parse(`import "fail"; fail()`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+
+	want := RuntimeError{Message: "division by zero", Position: token.Position{Line: 2, Column: 5}, File: "fail"}
+	if *runtimeErr != want {
+		t.Errorf("wrong error. want=%+v, got=%+v", want, *runtimeErr)
+	}
+}
+
+func TestLetValueBeforeName(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; function() { let x = x + 1; x }()", 2},
+		{"let x = 1; function() { let x = -x; x }()", -1},
+		{"let x = 1; function() { let x = [x]; x }()", []int{1}},
+		{`let x = 1; function() { let x = "${x}"; x }()`, "1"},
+		{"let x = 1; let x = x + 1; x", 2},
+		// Locals start out null, not with what an earlier call left.
+		{
+			`let g = function() { let a = 5; a }; g();
+			let h = function() { let b = function() { b }; b() }; h()`,
+			Null,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 5;", 5},
+		{"return 5; 6", 5},
+		{"let f = function() { 1 }; return f() + 1; 9", 2},
+		{"if (true) { return 3; }; 4", 3},
+		{"let f = function() { return 1; }; f(); 2", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -398,6 +785,245 @@ func TestRecursiveFibonacci(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestOptimizations(t *testing.T) {
+	inputs := []string{
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"-50 + 100 + -50",
+		"!(1 < 2) == false",
+		"!!5",
+		`"mon" + "key" + "banana"`,
+		"if (1 > 2) { 10 } else { 20 - 5 }",
+		"let x = 3; x * (2 + 2)",
+		"if (true) { 10 }; if (false) { 10 }",
+		"let f = function(x) { if (x > 1) { return x; 5 } else { 1 } }; f(3) + f(0)",
+		`let fibonacci = function(x) {
+			if (x == 0) { return 0; } else { if (x == 1) { return 1; } else { fibonacci(x - 1) + fibonacci(x - 2); } }
+		};
+		fibonacci(15);`,
+	}
+
+	for _, input := range inputs {
+		var results []string
+
+		options := []compiler.Options{
+			{},
+			{FoldConstants: true},
+			{Peephole: true},
+			{FoldConstants: true, Peephole: true},
+		}
+
+		for _, options := range options {
+			comp := compiler.NewWithOptions(options)
+
+			err := comp.Compile(parse(input))
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			vm := New(comp.Bytecode())
+
+			err = vm.Run()
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+
+			results = append(results, vm.LastPoppedStackElem().Inspect())
+		}
+
+		for i, result := range results[1:] {
+			if result != results[0] {
+				t.Errorf("%+v changed result of %q. want=%s, got=%s", options[i+1], input, results[0], result)
+			}
+		}
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	params := make([]string, 300)
+	args := make([]string, 300)
+	for i := range params {
+		params[i] = identifier(i)
+		args[i] = fmt.Sprintf("%d", i)
+	}
+
+	constants := make([]string, 70000)
+	for i := range constants {
+		constants[i] = fmt.Sprintf("%d", i)
+	}
+
+	tests := []vmTestCase{
+		{
+			input: fmt.Sprintf(
+				"let f = function(%s) { let x = %s + %s; x + %s }; f(%s)",
+				strings.Join(params, ", "), identifier(0), identifier(299), identifier(298),
+				strings.Join(args, ", ")),
+			expected: 597,
+		},
+		{
+			input:    strings.Join(constants, "; "),
+			expected: 69999,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGrowingStacks(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+		let countDown = function(x) {
+			if (x == 0) {
+				return 0;
+			}
+			1 + countDown(x - 1);
+		};
+		countDown(5000);
+		`,
+			expected: 5000,
+		},
+		{
+			input: `
+		let a = 1; let b = 2; let c = 3; let d = 4; let e = 5; let f = 6;
+		let g = 7; let h = 8; let i = 9; let j = 10; let k = 11; let l = 12;
+		let m = 13; let n = 14; let o = 15; let p = 16; let q = 17; let r = 18;
+		a + r;
+		`,
+			expected: 19,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		config   Config
+		expected string
+	}{
+		{
+			input:    `let f = function(x) { f(x + 1) }; f(0);`,
+			config:   Config{MaxFrames: 100},
+			expected: "stack overflow: MaxFrames (100) exceeded",
+		},
+		{
+			input:    `let f = function(x) { f(x + 1) }; f(0);`,
+			config:   Config{MaxStackSize: 100},
+			expected: "stack overflow: MaxStackSize (100) exceeded",
+		},
+		{
+			input:    `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10]`,
+			config:   Config{MaxStackSize: 8},
+			expected: "stack overflow: MaxStackSize (8) exceeded",
+		},
+		{
+			input:    `let f = function(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(50);`,
+			config:   Config{MaxInstructions: 1000},
+			expected: "execution limit: MaxInstructions (1000) exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithConfig(comp.Bytecode(), tt.config)
+
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestAssembledPrograms(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			.constant 0 integer 1
+			.constant 1 integer 10
+			.constant 2 integer 0
+
+			.function 3 locals=2 params=1
+				OpConstant 0
+				OpSetLocal 1
+			loop:
+				OpGetLocal 0
+				OpConstant 2
+				OpGreaterThan
+				OpJumpNotTruthy done
+				OpGetLocal 1
+				OpConstant 0
+				OpAdd
+				OpSetLocal 1
+				OpGetLocal 0
+				OpConstant 0
+				OpSub
+				OpSetLocal 0
+				OpJump loop
+			done:
+				OpGetLocal 1
+				OpReturnValue
+
+			.main
+				OpClosure 3 0
+				OpConstant 1
+				OpCall 1
+				OpPop
+			`,
+			expected: 11,
+		},
+		{
+			input: `
+			.main
+				OpNull
+				OpBang
+				OpPop
+			`,
+			expected: true,
+		},
+		{
+			input: `
+			.constant 0 string "a"
+			.main
+				OpConstant 0
+				OpConstant 0
+				OpHash 2
+				OpConstant 0
+				OpIndex
+				OpPop
+			`,
+			expected: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := asm.Assemble(tt.input)
+		if err != nil {
+			t.Fatalf("assembler error: %s", err)
+		}
+
+		vm := New(bytecode)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
@@ -464,15 +1090,16 @@ func testExpectedObject(t *testing.T, expected interface{}, actual ir.Object) {
 			return
 		}
 
-		if len(hash.Pairs) != len(expected) {
-			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hash.Pairs))
+		if hash.Len() != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), hash.Len())
 			return
 		}
 
-		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+		for _, pair := range hash.Pairs() {
+			expectedValue, ok := expected[pair.Key.(ir.Hashable).HashKey()]
 			if !ok {
-				t.Errorf("no pair for given key in pairs")
+				t.Errorf("unexpected key in pairs: %s", pair.Key.Inspect())
+				continue
 			}
 
 			err := testIntegerObject(expectedValue, pair.Value)
@@ -537,8 +1164,67 @@ func testStringObject(expected string, actual ir.Object) error {
 	return nil
 }
 
+// identifier returns a unique identifier for i. Identifiers can't contain
+// digits, so they are spelled with letters.
+func identifier(i int) string {
+	return "p" + strings.Map(func(r rune) rune { return r - '0' + 'a' }, fmt.Sprint(i))
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
 	return p.ParseProgram()
 }
+
+func FuzzRun(f *testing.F) {
+	seeds := []string{
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"!(if (false) { 5; }); if ((if (false) { 10 })) { 10 } else { 20 }",
+		`"mon" + "key" + "banana"; "a" < "b"; [1, [2]] == [1, [2]]`,
+		`let x = 41; "value: ${x + 1}, ${[true]}"`,
+		`{1: 1, 2: 2}[1]; [1, 2, 3][-1]; "monkey"[1:-1]`,
+		"let one = function() { 1; }; let two = function() { 2; }; one() + two()",
+		"function(a) { a }()",
+		"let newAdder = function(a, b) { function(c) { a + b + c } }; newAdder(1, 2)(8);",
+		"let fibonacci = function(x) { if (x < 2) { return x; } fibonacci(x - 1) + fibonacci(x - 2); }; fibonacci(15);",
+		"let f = function() { f() }; f()",
+		"1 / 0; {[1]: 2}; 1()",
+		`assert_error(function() { assert_eq([1], [2]) }, "x"); assert(false)`,
+		"function(){let f=f()}()",
+		"function(){let x = x + 1; x}()",
+		"function(){let x = -x; x}()",
+		"function(){let x = [x]; x}()",
+		`function(){let x = "${x}"; x}()`,
+		"let g = function(){ let a = 5; a }; g(); let h = function(){ let b = b; b }; h()",
+		"let g = function(){ let a = 5; a }; g(); let h = function(){ let b = function(){ b }; b() }; h()",
+		"return 5;",
+		"if (true) { return 1; }; 2",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	config := Config{MaxStackSize: 1 << 12, MaxFrames: 1 << 8, MaxInstructions: 1 << 16}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		comp := compiler.New()
+		if comp.Compile(program) != nil {
+			return
+		}
+
+		bytecode := comp.Bytecode()
+
+		err := verifier.Verify(bytecode)
+		if err != nil {
+			t.Fatalf("compiler produced invalid bytecode: %s", err)
+		}
+
+		NewWithConfig(bytecode, config).Run()
+	})
+}